@@ -16,6 +16,8 @@ type Buffer interface {
 	io.Writer
 	// reader interface implementation
 	io.Reader
+	// start the next read again from the first line
+	Rewind()
 	// return a slice of the lines in the buffer
 	Lines() []string
 	// insert toInsert at the specified index
@@ -26,21 +28,36 @@ type Buffer interface {
 	DeleteLine(lineIndex int) (err error)
 	// clears all lines from the buffer
 	Clear() (err error)
+	// the cursor of whichever view is currently working on the buffer. views
+	// own their cursors and load them into the buffer before editing it
 	SetCursor(location Point) (err error)
 	Cursor() (cursor Point)
+	// keep point on the same line as lines are inserted or deleted above it
+	Track(point *Point)
+	// stop adjusting a point passed to Track
+	Untrack(point *Point)
 	//MoveCursor(cursor Point, delta Point) (cursor Point) TODO: ADD THIS FOR SURESIES
-	//Save() (err error)
+	// write the buffer out using its saver
+	Save() (err error)
+	// set where the buffer is written to when saved
+	SetSaver(saver Saver)
+	// return where the buffer is written to when saved, nil if it has nowhere to go
+	Saver() Saver
 }
 
 // base implementation of the Buffer interface
 type BaseBuffer struct {
 	lines  []string
 	cursor Point
-	// we save by writing out the buffer to io.Writer
-	//saver io.Writer
+	// we save by writing out the buffer to the saver
+	saver Saver
 
 	// next point to read (for implementing the read interface)
 	readNext Point
+
+	// points kept in place as lines are inserted and deleted, such as the
+	// cursors of views showing the buffer
+	tracked []*Point
 }
 
 // generalized function to stringify a buffer
@@ -72,9 +89,42 @@ func (buffer *BaseBuffer) Write(bytes []byte) (int, error) {
 	return len(bytes), nil
 }
 
-func (buffer *BaseBuffer) Read(bytes []byte) (int, error) {
-	// TODO: Implement reader
-	return -1, errors.New("not yet implemented")
+// read the buffer contents, continuing from where the previous read stopped.
+// lines are separated rather than terminated by newlines so a file that was
+// loaded and read back out is unchanged. once the whole buffer has been read
+// io.EOF is returned and the next read starts again from the first line
+func (buffer *BaseBuffer) Read(bytes []byte) (n int, err error) {
+	for n < len(bytes) && buffer.readNext.y < len(buffer.lines) {
+		line := buffer.lines[buffer.readNext.y]
+
+		// the line may have been shortened since the last read
+		if buffer.readNext.x > len(line) {
+			buffer.readNext.x = len(line)
+		}
+
+		if buffer.readNext.x < len(line) {
+			copied := copy(bytes[n:], line[buffer.readNext.x:])
+			buffer.readNext.x += copied
+			n += copied
+			continue
+		}
+
+		if buffer.readNext.y < len(buffer.lines)-1 {
+			bytes[n] = '\n'
+			n++
+		}
+		buffer.readNext = Point{0, buffer.readNext.y + 1}
+	}
+
+	if n == 0 && len(bytes) > 0 {
+		buffer.readNext = Point{}
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (buffer *BaseBuffer) Rewind() {
+	buffer.readNext = Point{}
 }
 
 // writer interface implementation
@@ -118,6 +168,12 @@ func (buffer *BaseBuffer) InsertLine(lineIndex int, toInsert string) (err error)
 	// shift elements right
 	copy(buffer.lines[lineIndex+1:], buffer.lines[lineIndex:])
 	buffer.lines[lineIndex] = toInsert
+
+	for _, point := range buffer.tracked {
+		if point.y >= lineIndex {
+			point.y++
+		}
+	}
 	return
 }
 
@@ -147,12 +203,23 @@ func (buffer *BaseBuffer) DeleteLine(lineIndex int) (err error) {
 	} else {
 		buffer.lines = append(buffer.lines[:lineIndex], buffer.lines[lineIndex+1:]...)
 	}
+
+	// points on the deleted line stay put and end up on the line after it
+	for _, point := range buffer.tracked {
+		if point.y > lineIndex {
+			point.y--
+		}
+	}
 	return
 }
 
 // clears all lines from the buffer
 func (buffer *BaseBuffer) Clear() (err error) {
 	buffer.lines = []string{}
+	buffer.readNext = Point{}
+	for _, point := range buffer.tracked {
+		*point = Point{}
+	}
 	return
 }
 
@@ -167,3 +234,33 @@ func (buffer *BaseBuffer) SetCursor(location Point) (err error) {
 func (buffer *BaseBuffer) Cursor() (cursor Point) {
 	return buffer.cursor
 }
+
+func (buffer *BaseBuffer) Track(point *Point) {
+	buffer.tracked = append(buffer.tracked, point)
+}
+
+func (buffer *BaseBuffer) Untrack(point *Point) {
+	for i, tracked := range buffer.tracked {
+		if tracked == point {
+			buffer.tracked = append(buffer.tracked[:i], buffer.tracked[i+1:]...)
+			return
+		}
+	}
+}
+
+func (buffer *BaseBuffer) Save() (err error) {
+	if buffer.saver == nil {
+		return ErrNoFileName
+	}
+	// always save the whole buffer, even if someone stopped reading part way
+	buffer.Rewind()
+	return buffer.saver.Save(buffer)
+}
+
+func (buffer *BaseBuffer) SetSaver(saver Saver) {
+	buffer.saver = saver
+}
+
+func (buffer *BaseBuffer) Saver() Saver {
+	return buffer.saver
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // base buffer test functions
@@ -257,3 +260,126 @@ func TestJoin(t *testing.T) {
 		t.Fatal("Invalid line index should fail")
 	}
 }
+
+func TestRead(t *testing.T) {
+	contents := "line0\nline1\n\nline3\n"
+	buffer := &BaseBuffer{}
+	Load(buffer, strings.NewReader(contents))
+
+	// read a byte at a time to make sure we can stop and continue mid line
+	read, err := ioutil.ReadAll(iotest.OneByteReader(buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != contents {
+		t.Fatalf("read '%s', expected '%s'", read, contents)
+	}
+
+	// reading again should start over with the current contents
+	buffer.SetLine(1, "new1")
+	read, err = ioutil.ReadAll(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "line0\nnew1\n\nline3\n"; string(read) != expected {
+		t.Fatalf("read '%s', expected '%s'", read, expected)
+	}
+
+	// copying into another buffer should give the same lines
+	copied := &BaseBuffer{}
+	if _, err = io.Copy(copied, buffer); err != nil {
+		t.Fatal(err)
+	}
+	if copied.String() != buffer.String() {
+		t.Fatalf("copied '%s', expected '%s'", copied, buffer)
+	}
+
+	buffer.Clear()
+	read, err = ioutil.ReadAll(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 0 {
+		t.Fatalf("read '%s' from a cleared buffer", read)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	buffer := &BaseBuffer{}
+	Load(buffer, strings.NewReader("line0\nline1\nline2\nline3"))
+	above := Point{2, 0}
+	below := Point{3, 2}
+	buffer.Track(&above)
+	buffer.Track(&below)
+
+	buffer.InsertLine(1, "new1")
+	if above.y != 0 || below.y != 3 {
+		t.Fatalf("after insert: above %v, below %v", above, below)
+	}
+
+	buffer.DeleteLine(0)
+	if above.y != 0 || below.y != 2 || below.x != 3 {
+		t.Fatalf("after delete: above %v, below %v", above, below)
+	}
+
+	buffer.Untrack(&below)
+	buffer.DeleteLine(0)
+	if below.y != 2 {
+		t.Fatal("untracked point was moved")
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	buffer := &BaseBuffer{}
+	Load(buffer, strings.NewReader("line0\nline1"))
+	err := SplitLine(buffer, Point{2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buffer.Lines()) != 3 || buffer.Lines()[0] != "li" || buffer.Lines()[1] != "ne0" {
+		t.Fatal(buffer)
+	}
+
+	err = SplitLine(buffer, Point{5, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buffer.Lines()) != 4 || buffer.Lines()[2] != "line1" || buffer.Lines()[3] != "" {
+		t.Fatal(buffer)
+	}
+
+	err = SplitLine(buffer, Point{1, 3})
+	if err == nil {
+		t.Fatal("split at invalid location should fail")
+	}
+}
+
+func TestBackspace(t *testing.T) {
+	buffer := &BaseBuffer{}
+	Load(buffer, strings.NewReader("line0\n  line1"))
+	p, err := Backspace(buffer, Point{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.Lines()[1] != " line1" || p != (Point{1, 1}) {
+		t.Fatal(p, buffer)
+	}
+
+	// joining at the start of the line doesn't trim whitespace like Join
+	p, err = Backspace(buffer, Point{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buffer.Lines()) != 1 || buffer.Lines()[0] != "line0 line1" || p != (Point{5, 0}) {
+		t.Fatal(p, buffer)
+	}
+
+	p, err = Backspace(buffer, Point{0, 0})
+	if err != nil || p != (Point{0, 0}) || buffer.Lines()[0] != "line0 line1" {
+		t.Fatal("backspace at the start of the buffer should do nothing")
+	}
+}
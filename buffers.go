@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+)
+
+// an entry in the buffer list
+type BufferEntry struct {
+	id     int
+	buffer Buffer
+	// used when the buffer has no file to take its name from
+	name string
+}
+
+// the list of every buffer the editor has loaded. buffers are given ids
+// counting up from 1 which are never reused
+type BufferList struct {
+	entries []*BufferEntry
+	next_id int
+}
+
+// the file name of the buffer if it has one
+func (entry *BufferEntry) Path() string {
+	if saver := entry.buffer.Saver(); saver != nil {
+		return saver.Path()
+	}
+	return ""
+}
+
+func (entry *BufferEntry) Name() string {
+	if path := entry.Path(); path != "" {
+		return path
+	} else if entry.name != "" {
+		return entry.name
+	}
+	return "[No Name]"
+}
+
+// returns true if the buffer has changed since it was last saved
+func (entry *BufferEntry) Modified() bool {
+	undoer, ok := entry.buffer.(Undoer)
+	return ok && undoer.Modified()
+}
+
+// a line describing the buffer for :ls
+func (entry *BufferEntry) String() string {
+	modified := ' '
+	if entry.Modified() {
+		modified = '+'
+	}
+	return fmt.Sprintf("%3d %c \"%s\" line %d", entry.id, modified, entry.Name(), entry.buffer.Cursor().y+1)
+}
+
+// add a buffer to the list, name is only used if the buffer has no file name
+func (list *BufferList) Add(buffer Buffer, name string) *BufferEntry {
+	list.next_id++
+	entry := &BufferEntry{id: list.next_id, buffer: buffer, name: name}
+	list.entries = append(list.entries, entry)
+	return entry
+}
+
+func (list *BufferList) Len() int {
+	return len(list.entries)
+}
+
+// return the entry for buffer, nil if it is not in the list
+func (list *BufferList) Find(buffer Buffer) *BufferEntry {
+	if index := list.index(buffer); index >= 0 {
+		return list.entries[index]
+	}
+	return nil
+}
+
+// return the entry with the given id, nil if there is none
+func (list *BufferList) FindId(id int) *BufferEntry {
+	for _, entry := range list.entries {
+		if entry.id == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// return the buffer offset entries away from buffer, wrapping around the ends
+// of the list
+func (list *BufferList) Next(buffer Buffer, offset int) Buffer {
+	if len(list.entries) == 0 {
+		return nil
+	}
+
+	index := list.index(buffer)
+	if index < 0 {
+		index = 0
+	}
+	index = (index + offset) % len(list.entries)
+	if index < 0 {
+		index += len(list.entries)
+	}
+	return list.entries[index].buffer
+}
+
+// remove buffer from the list
+func (list *BufferList) Remove(buffer Buffer) {
+	if index := list.index(buffer); index >= 0 {
+		list.entries = append(list.entries[:index], list.entries[index+1:]...)
+	}
+}
+
+func (list *BufferList) index(buffer Buffer) int {
+	for i, entry := range list.entries {
+		if entry.buffer == buffer {
+			return i
+		}
+	}
+	return -1
+}
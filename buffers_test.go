@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBufferList(t *testing.T) {
+	var list BufferList
+	buffers := []Buffer{NewScratchBuffer(), NewScratchBuffer(), NewScratchBuffer()}
+	for _, buffer := range buffers {
+		list.Add(buffer, "")
+	}
+
+	if list.Next(buffers[2], 1) != buffers[0] {
+		t.Fatal("next should wrap around to the first buffer")
+	}
+	if list.Next(buffers[0], -1) != buffers[2] {
+		t.Fatal("previous should wrap around to the last buffer")
+	}
+
+	list.Remove(buffers[1])
+	if list.Len() != 2 || list.Find(buffers[1]) != nil {
+		t.Fatal("buffer was not removed")
+	}
+
+	// ids are never reused
+	entry := list.Add(NewScratchBuffer(), "")
+	if entry.id != 4 || list.FindId(2) != nil {
+		t.Fatalf("unexpected id %d", entry.id)
+	}
+}
+
+func TestModified(t *testing.T) {
+	var list BufferList
+	buffer := NewUndoer(&BaseBuffer{})
+	Load(buffer, strings.NewReader("line0\nline1"))
+	entry := list.Add(buffer, "")
+	if entry.Modified() {
+		t.Fatal("a freshly loaded buffer should not be modified")
+	}
+
+	SetLine(buffer, 0, "new0")
+	if !entry.Modified() {
+		t.Fatal("buffer should be modified after a change")
+	}
+
+	buffer.Undo()
+	if entry.Modified() {
+		t.Fatal("undoing every change should leave the buffer unmodified")
+	}
+
+	buffer.Redo()
+	if !entry.Modified() {
+		t.Fatal("buffer should be modified after redoing a change")
+	}
+}
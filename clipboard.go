@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// the system clipboard behind the + and * registers. selection is true for
+// the primary selection ("*), which systems without one share with the
+// clipboard
+type Clipboard interface {
+	Get(selection bool) (text string, err error)
+	Set(selection bool, text string) (err error)
+}
+
+// the providers which can be chosen with the clipboardprovider option, besides
+// "auto" which picks the first one that works here
+var clipboardProviders = []string{"wl-copy", "xclip", "xsel", "pbcopy", "osc52", "memory"}
+
+// create the clipboard provider with the given name
+func NewClipboard(provider string) (Clipboard, error) {
+	switch provider {
+	case "auto":
+		return NewClipboard(detectClipboardProvider())
+	case "wl-copy":
+		return &commandClipboard{
+			copy:           []string{"wl-copy"},
+			paste:          []string{"wl-paste", "--no-newline"},
+			copySelection:  []string{"wl-copy", "--primary"},
+			pasteSelection: []string{"wl-paste", "--primary", "--no-newline"},
+		}, nil
+	case "xclip":
+		return &commandClipboard{
+			copy:           []string{"xclip", "-selection", "clipboard", "-in"},
+			paste:          []string{"xclip", "-selection", "clipboard", "-out"},
+			copySelection:  []string{"xclip", "-selection", "primary", "-in"},
+			pasteSelection: []string{"xclip", "-selection", "primary", "-out"},
+		}, nil
+	case "xsel":
+		return &commandClipboard{
+			copy:           []string{"xsel", "--clipboard", "--input"},
+			paste:          []string{"xsel", "--clipboard", "--output"},
+			copySelection:  []string{"xsel", "--primary", "--input"},
+			pasteSelection: []string{"xsel", "--primary", "--output"},
+		}, nil
+	case "pbcopy":
+		return &commandClipboard{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}, nil
+	case "osc52":
+		return &osc52Clipboard{}, nil
+	case "memory":
+		return &memoryClipboard{}, nil
+	}
+	return nil, errors.New("unknown clipboard provider: " + provider)
+}
+
+// pick the clipboard tool for the display we are running on. over ssh, or
+// when there is no tool installed, the terminal is asked to set the clipboard
+func detectClipboardProvider() string {
+	found := func(command string) bool {
+		_, err := exec.LookPath(command)
+		return err == nil
+	}
+
+	switch {
+	case os.Getenv("SSH_TTY") != "":
+	case os.Getenv("WAYLAND_DISPLAY") != "" && found("wl-copy") && found("wl-paste"):
+		return "wl-copy"
+	case os.Getenv("DISPLAY") != "" && found("xclip"):
+		return "xclip"
+	case os.Getenv("DISPLAY") != "" && found("xsel"):
+		return "xsel"
+	case found("pbcopy") && found("pbpaste"):
+		return "pbcopy"
+	}
+	return "osc52"
+}
+
+// a clipboard reached through commands which copy their standard input and
+// paste to their standard output. the selection commands may be nil if the
+// system has no primary selection
+type commandClipboard struct {
+	copy           []string
+	paste          []string
+	copySelection  []string
+	pasteSelection []string
+}
+
+func (clipboard *commandClipboard) Get(selection bool) (string, error) {
+	command := clipboard.paste
+	if selection && clipboard.pasteSelection != nil {
+		command = clipboard.pasteSelection
+	}
+
+	output, err := exec.Command(command[0], command[1:]...).Output()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("%s: %v", command[0], err))
+	}
+	return string(output), nil
+}
+
+func (clipboard *commandClipboard) Set(selection bool, text string) error {
+	command := clipboard.copy
+	if selection && clipboard.copySelection != nil {
+		command = clipboard.copySelection
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return errors.New(fmt.Sprintf("%s: %v", command[0], err))
+	}
+	return nil
+}
+
+// sets the clipboard of the terminal we are running in with an OSC 52 escape
+// sequence, which works over ssh. terminals rarely let us read the clipboard
+// back, so getting it returns what we last set
+type osc52Clipboard struct {
+	// where the sequences are written, the controlling terminal when nil
+	writer io.Writer
+	memoryClipboard
+}
+
+func (clipboard *osc52Clipboard) Set(selection bool, text string) error {
+	target := "c"
+	if selection {
+		target = "p"
+	}
+
+	writer := clipboard.writer
+	if writer == nil {
+		// termbox draws to /dev/tty rather than standard output, which may not
+		// even be the terminal, so the sequence goes there too
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer tty.Close()
+		writer = tty
+	}
+
+	// termbox only writes when it is flushed, so a sequence written in one go
+	// between flushes can't end up in the middle of what it draws
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	sequence := fmt.Sprintf("\x1b]52;%s;%s\a", target, encoded)
+	if _, err := io.WriteString(writer, sequence); err != nil {
+		return err
+	}
+	return clipboard.memoryClipboard.Set(selection, text)
+}
+
+// a clipboard private to the editor
+type memoryClipboard struct {
+	clipboard string
+	selection string
+}
+
+func (clipboard *memoryClipboard) Get(selection bool) (string, error) {
+	if selection {
+		return clipboard.selection, nil
+	}
+	return clipboard.clipboard, nil
+}
+
+func (clipboard *memoryClipboard) Set(selection bool, text string) error {
+	if selection {
+		clipboard.selection = text
+	} else {
+		clipboard.clipboard = text
+	}
+	return nil
+}
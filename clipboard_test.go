@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestClipboardRegisters(t *testing.T) {
+	var vim Vim
+	vim.init()
+	clipboard := &memoryClipboard{}
+	vim.registers.clipboard = func() (Clipboard, error) { return clipboard, nil }
+	buffer := newTestBuffer("one two\nthree")
+
+	performKeys(t, &vim, buffer, "\"+yy\"*yw")
+	if clipboard.clipboard != "one two\n" || clipboard.selection != "one " {
+		t.Fatalf("clipboard '%s' selection '%s'", clipboard.clipboard, clipboard.selection)
+	}
+
+	// text copied elsewhere is put as whole lines when it ends in a line break
+	clipboard.Set(false, "pasted\n")
+	performKeys(t, &vim, buffer, "\"+p")
+	if expected := "one two\npasted\nthree\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s', expected '%s'", StringifyBuffer(buffer), expected)
+	}
+	performKeys(t, &vim, buffer, "\"*P")
+	if expected := "one two\none pasted\nthree\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s', expected '%s'", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestOSC52Clipboard(t *testing.T) {
+	var terminal bytes.Buffer
+	clipboard := &osc52Clipboard{writer: &terminal}
+
+	if err := clipboard.Set(false, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\x1b]52;c;aGVsbG8=\a"; terminal.String() != expected {
+		t.Fatalf("wrote %q, expected %q", terminal.String(), expected)
+	}
+	if text, _ := clipboard.Get(false); text != "hello" {
+		t.Fatalf("got '%s' back, expected 'hello'", text)
+	}
+
+	// the provider writes to the terminal rather than standard output
+	if provider, _ := NewClipboard("osc52"); provider.(*osc52Clipboard).writer != nil {
+		t.Fatal("osc52 provider should write to /dev/tty")
+	}
+}
+
+func TestClipboardProviders(t *testing.T) {
+	for _, provider := range append(clipboardProviders, "auto") {
+		if _, err := NewClipboard(provider); err != nil {
+			t.Errorf("NewClipboard(%s) error: %v", provider, err)
+		}
+	}
+	if _, err := NewClipboard("clippy"); err == nil {
+		t.Errorf("NewClipboard(clippy) succeeded")
+	}
+
+	settings := Settings{clipboardProvider: "memory"}
+	first, _ := settings.Clipboard()
+	if again, _ := settings.Clipboard(); again != first {
+		t.Errorf("clipboard recreated without the provider changing")
+	}
+	settings.Set("cbp=osc52")
+	if changed, _ := settings.Clipboard(); changed == first {
+		t.Errorf("clipboard not recreated after changing the provider")
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// runs an ex command on the selected view. force is true when the command
+// name ended with '!'
+type CommandFunc func(editor *Editor, view *View, args []string, force bool) error
+
+// runs an ex command which works on a range of lines. arg is everything typed
+// after the command's name
+type RangeCommandFunc func(editor *Editor, view *View, lines LineRange, arg string, force bool) error
+
+type Command struct {
+	name string
+	// the shortest prefix of name which runs the command
+	abbreviation string
+	function     CommandFunc
+	// set instead of function for commands which take a range
+	ranged RangeCommandFunc
+}
+
+// the ex commands, earlier commands win when an abbreviation is ambiguous.
+// filled in by init, as :g runs commands itself
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{"write", "w", writeCommand, nil},
+		{"wq", "wq", writeQuitCommand, nil},
+		{"wall", "wa", writeAllCommand, nil},
+		{"xit", "x", writeQuitIfModifiedCommand, nil},
+		{"quit", "q", quitViewCommand, nil},
+		{"qall", "qa", quitCommand, nil},
+		{"edit", "e", editCommand, nil},
+		{"split", "sp", splitCommand, nil},
+		{"vsplit", "vs", vsplitCommand, nil},
+		{"close", "clo", closeCommand, nil},
+		{"tabnew", "tabnew", tabNewCommand, nil},
+		{"tabnext", "tabn", tabNextCommand, nil},
+		{"tabprevious", "tabp", tabPreviousCommand, nil},
+		{"tabNext", "tabN", tabPreviousCommand, nil},
+		{"tabclose", "tabc", tabCloseCommand, nil},
+		{"set", "se", setCommand, nil},
+		{"ls", "ls", listBuffersCommand, nil},
+		{"buffers", "buffers", listBuffersCommand, nil},
+		{"files", "files", listBuffersCommand, nil},
+		{"buffer", "b", bufferCommand, nil},
+		{"bnext", "bn", bufferNextCommand, nil},
+		{"bprevious", "bp", bufferPreviousCommand, nil},
+		{"bNext", "bN", bufferPreviousCommand, nil},
+		{"bdelete", "bd", bufferDeleteCommand, nil},
+		{"substitute", "s", nil, substituteCommand},
+		{"delete", "d", nil, deleteCommand},
+		{"move", "m", nil, moveCommand},
+		{"copy", "co", nil, copyCommand},
+		{"t", "t", nil, copyCommand},
+		{"normal", "norm", nil, normalCommand},
+		{"global", "g", nil, globalCommand},
+		{"vglobal", "v", nil, vglobalCommand},
+	}
+}
+
+// find the command name refers to, either by its full name or an abbreviation
+func findCommand(name string) *Command {
+	for i := range commands {
+		command := &commands[i]
+		if strings.HasPrefix(command.name, name) && len(name) >= len(command.abbreviation) {
+			return command
+		}
+	}
+	return nil
+}
+
+// run an ex command (without the leading ':') on the selected view and the
+// buffer it shows
+func RunCommand(editor *Editor, command string) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+
+	view := editor.SelectedView()
+	if view == nil {
+		return errors.New("no view selected")
+	}
+
+	lines, rest, err := parseRange(editor, view, command)
+	if err != nil {
+		return err
+	}
+
+	name, arg, force := splitCommandName(rest)
+	if name == "" {
+		// a range on its own moves to its last line
+		if !lines.given || strings.TrimSpace(arg) != "" {
+			return errors.New("not an editor command: " + command)
+		}
+		line := view.buffer.Lines()[lines.end]
+		return view.buffer.SetCursor(Point{firstNonBlank(line), lines.end})
+	}
+
+	found := findCommand(name)
+	if found == nil {
+		return errors.New("not an editor command: " + command)
+	}
+	if found.ranged != nil {
+		return found.ranged(editor, view, lines, arg, force)
+	}
+	if lines.given {
+		return errors.New("no range allowed")
+	}
+	return found.function(editor, view, strings.Fields(arg), force)
+}
+
+// split an ex command after its range into its name, which is the letters at
+// its start, and its argument. a ! after the name forces commands which would
+// otherwise refuse to run
+func splitCommandName(command string) (name string, arg string, force bool) {
+	command = strings.TrimLeft(command, " \t")
+	name_length := strings.IndexFunc(command, func(ch rune) bool { return !unicode.IsLetter(ch) })
+	if name_length < 0 {
+		name_length = len(command)
+	}
+	name, arg = command[:name_length], command[name_length:]
+	force = strings.HasPrefix(arg, "!")
+	return name, strings.TrimPrefix(arg, "!"), force
+}
+
+// finish the command line, running the ex command or handing the response to
+// the prompt that asked for it. errors are shown on the status row
+func (editor *Editor) FinishCommandLine() {
+	command_line := &editor.command_line
+	response, callback := command_line.Finish()
+
+	var err error
+	if callback != nil {
+		err = callback(response)
+	} else {
+		err = RunCommand(editor, response)
+	}
+
+	view := editor.SelectedView()
+	switch {
+	case err == nil:
+	case err == ErrNoFileName && view != nil:
+		promptFileName(command_line, view.buffer, nil)
+	case err == ErrUnsupportedCompression && view != nil:
+		promptSaveUncompressed(command_line, view.buffer)
+	default:
+		command_line.ShowError(err)
+	}
+}
+
+// complete a command name, or the last argument as a file name or option
+func (editor *Editor) CompleteCommand(text string) (completions []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+
+	if len(fields) == 1 && !strings.HasSuffix(text, " ") {
+		for _, command := range commands {
+			if strings.HasPrefix(command.name, fields[0]) {
+				completions = append(completions, command.name)
+			}
+		}
+		return
+	}
+
+	// complete the argument being typed, which may be empty
+	prefix := text
+	arg := ""
+	if !strings.HasSuffix(text, " ") {
+		arg = fields[len(fields)-1]
+		prefix = text[:len(text)-len(arg)]
+	}
+
+	command := findCommand(strings.TrimSuffix(fields[0], "!"))
+	if command != nil && command.name == "set" {
+		for _, option := range editor.settings.options() {
+			if strings.HasPrefix(option.name, arg) {
+				completions = append(completions, prefix+option.name)
+			}
+		}
+		return
+	}
+
+	matches, _ := filepath.Glob(arg + "*")
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			match += string(filepath.Separator)
+		}
+		completions = append(completions, prefix+match)
+	}
+	return
+}
+
+// ask for a file name to save a buffer which doesn't have one yet. saved, if
+// not nil, is called once the buffer has been saved
+func promptFileName(command_line *CommandLine, buffer Buffer, saved func() error) {
+	command_line.Prompt("save as: ", func(response string) error {
+		if response == "" {
+			promptFileName(command_line, buffer, saved)
+			return nil
+		}
+		if err := SaveAs(buffer, response); err != nil || saved == nil {
+			return err
+		}
+		return saved()
+	})
+}
+
+// ask whether a buffer whose compression we have no encoder for should be
+// saved as plain text instead
+func promptSaveUncompressed(command_line *CommandLine, buffer Buffer) {
+	saver, ok := buffer.Saver().(*FileSaver)
+	if !ok {
+		return
+	}
+
+	prompt := fmt.Sprintf("can't write %v files, save %s uncompressed? (y/n) ", saver.compression, saver.path)
+	command_line.Prompt(prompt, func(response string) error {
+		if response != "y" {
+			return nil
+		}
+		saver.compression = COMPRESSION_NONE
+		return buffer.Save()
+	})
+}
+
+func writeBuffer(buffer Buffer, args []string) error {
+	switch len(args) {
+	case 0:
+		return buffer.Save()
+	case 1:
+		return SaveAs(buffer, args[0])
+	}
+	return errors.New("too many file names")
+}
+
+func writeCommand(editor *Editor, view *View, args []string, force bool) error {
+	return writeBuffer(view.buffer, args)
+}
+
+func writeQuitCommand(editor *Editor, view *View, args []string, force bool) error {
+	if err := writeBuffer(view.buffer, args); err != nil {
+		return quitAfterPrompt(editor, view, err, force)
+	}
+	return quitViewCommand(editor, view, nil, force)
+}
+
+// like :wq but only writes if there is something new to write
+func writeQuitIfModifiedCommand(editor *Editor, view *View, args []string, force bool) error {
+	entry := editor.buffers.Find(view.buffer)
+	if len(args) > 0 || entry == nil || entry.Modified() {
+		if err := writeBuffer(view.buffer, args); err != nil {
+			return quitAfterPrompt(editor, view, err, force)
+		}
+	}
+	return quitViewCommand(editor, view, nil, force)
+}
+
+// a buffer without a file name is saved once one is typed, and then the view
+// is closed as by :q. any other error from writing is returned
+func quitAfterPrompt(editor *Editor, view *View, err error, force bool) error {
+	if err != ErrNoFileName {
+		return err
+	}
+	promptFileName(&editor.command_line, view.buffer, func() error {
+		return quitViewCommand(editor, view, nil, force)
+	})
+	return nil
+}
+
+func writeAllCommand(editor *Editor, view *View, args []string, force bool) error {
+	for _, entry := range editor.buffers.entries {
+		if entry.Modified() {
+			if err := entry.buffer.Save(); err != nil {
+				return fmt.Errorf("%s: %v", entry.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// exit the editor, refusing to lose unsaved changes unless forced
+func quitCommand(editor *Editor, view *View, args []string, force bool) error {
+	if !force {
+		for _, entry := range editor.buffers.entries {
+			if entry.Modified() {
+				return fmt.Errorf("no write since last change for buffer %d (add ! to override)", entry.id)
+			}
+		}
+	}
+	editor.quit = true
+	return nil
+}
+
+// close the view, or its tab when it is the only view there, and exit the
+// editor once the last view is closed. unsaved changes are only lost when
+// forced, though they are kept while another view still shows the buffer
+func quitViewCommand(editor *Editor, view *View, args []string, force bool) error {
+	views, shown := 0, 0
+	editor.ForEachView(func(other *View) {
+		views++
+		if other.buffer == view.buffer {
+			shown++
+		}
+	})
+	if views == 1 {
+		return quitCommand(editor, view, args, force)
+	}
+
+	if entry := editor.buffers.Find(view.buffer); !force && shown == 1 && entry != nil && entry.Modified() {
+		return fmt.Errorf("no write since last change for buffer %d (add ! to override)", entry.id)
+	}
+	if viewLayoutCount(editor.CurrentTab().root) == 1 {
+		return tabCloseCommand(editor, view, args, force)
+	}
+	return closeCommand(editor, view, args, force)
+}
+
+// open a file (or switch to it if it is already open) in the view
+func editCommand(editor *Editor, view *View, args []string, force bool) error {
+	if len(args) != 1 {
+		return errors.New("expected one file name")
+	}
+
+	buffer, err := editor.OpenFile(args[0])
+	if err != nil {
+		return err
+	}
+	editor.ShowBuffer(view, buffer)
+	return nil
+}
+
+func splitCommand(editor *Editor, view *View, args []string, force bool) error {
+	return editor.SplitView(true, args)
+}
+
+func vsplitCommand(editor *Editor, view *View, args []string, force bool) error {
+	return editor.SplitView(false, args)
+}
+
+func closeCommand(editor *Editor, view *View, args []string, force bool) error {
+	tab := editor.CurrentTab()
+	if viewLayoutCount(tab.root) == 1 {
+		return errors.New("cannot close last window")
+	}
+	tab.Remove()
+	return nil
+}
+
+// open a tab showing the file given, or a new scratch buffer
+func tabNewCommand(editor *Editor, view *View, args []string, force bool) error {
+	var buffer Buffer
+	switch len(args) {
+	case 0:
+		buffer = NewScratchBuffer()
+		editor.buffers.Add(buffer, "")
+	case 1:
+		var err error
+		if buffer, err = editor.OpenFile(args[0]); err != nil {
+			return err
+		}
+	default:
+		return errors.New("too many file names")
+	}
+
+	editor.tabs.tabs = append(editor.tabs.tabs, NewTabLayout(NewViewLayout(buffer)))
+	editor.tabs.selection = len(editor.tabs.tabs) - 1
+	return nil
+}
+
+func tabNextCommand(editor *Editor, view *View, args []string, force bool) error {
+	editor.tabs.selection = (editor.tabs.selection + 1) % len(editor.tabs.tabs)
+	return nil
+}
+
+func tabPreviousCommand(editor *Editor, view *View, args []string, force bool) error {
+	editor.tabs.selection = (editor.tabs.selection + len(editor.tabs.tabs) - 1) % len(editor.tabs.tabs)
+	return nil
+}
+
+func tabCloseCommand(editor *Editor, view *View, args []string, force bool) error {
+	tabs := &editor.tabs
+	if len(tabs.tabs) == 1 {
+		return errors.New("cannot close last tab page")
+	}
+
+	// stop the buffers adjusting the cursors of the views we remove
+	forEachView(tabs.tabs[tabs.selection].root, func(view *View) { view.SetBuffer(nil) })
+	tabs.tabs = append(tabs.tabs[:tabs.selection], tabs.tabs[tabs.selection+1:]...)
+	if tabs.selection >= len(tabs.tabs) {
+		tabs.selection = len(tabs.tabs) - 1
+	}
+	return nil
+}
+
+func setCommand(editor *Editor, view *View, args []string, force bool) error {
+	var messages []string
+	if len(args) == 0 {
+		for _, option := range editor.settings.options() {
+			messages = append(messages, option.String())
+		}
+	}
+
+	for _, arg := range args {
+		message, err := editor.settings.Set(arg)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+
+	if len(messages) > 0 {
+		editor.command_line.ShowMessage(strings.Join(messages, "\n"))
+	}
+	return nil
+}
+
+func listBuffersCommand(editor *Editor, view *View, args []string, force bool) error {
+	var listing []string
+	for _, entry := range editor.buffers.entries {
+		listing = append(listing, entry.String())
+	}
+	editor.command_line.ShowMessage(strings.Join(listing, "\n"))
+	return nil
+}
+
+// find the buffer with the id given in args, or the view's buffer if no id is given
+func findBufferArg(editor *Editor, view *View, args []string) (*BufferEntry, error) {
+	switch len(args) {
+	case 0:
+		return editor.buffers.Find(view.buffer), nil
+	case 1:
+		id, err := strconv.Atoi(args[0])
+		if entry := editor.buffers.FindId(id); err == nil && entry != nil {
+			return entry, nil
+		}
+		return nil, errors.New("no such buffer: " + args[0])
+	}
+	return nil, errors.New("too many arguments")
+}
+
+// show the buffer with the given id in the view
+func bufferCommand(editor *Editor, view *View, args []string, force bool) error {
+	if len(args) == 0 {
+		return errors.New("expected a buffer number")
+	}
+
+	entry, err := findBufferArg(editor, view, args)
+	if err != nil {
+		return err
+	}
+	editor.ShowBuffer(view, entry.buffer)
+	return nil
+}
+
+func bufferNextCommand(editor *Editor, view *View, args []string, force bool) error {
+	editor.ShowBuffer(view, editor.buffers.Next(view.buffer, 1))
+	return nil
+}
+
+func bufferPreviousCommand(editor *Editor, view *View, args []string, force bool) error {
+	editor.ShowBuffer(view, editor.buffers.Next(view.buffer, -1))
+	return nil
+}
+
+// remove a buffer from the buffer list, refusing to lose unsaved changes unless forced
+func bufferDeleteCommand(editor *Editor, view *View, args []string, force bool) error {
+	entry, err := findBufferArg(editor, view, args)
+	if err != nil {
+		return err
+	} else if entry == nil {
+		return errors.New("buffer is not in the buffer list")
+	}
+
+	if entry.Modified() && !force {
+		return fmt.Errorf("no write since last change for buffer %d (add ! to override)", entry.id)
+	}
+	editor.DeleteBuffer(entry.buffer)
+	return nil
+}
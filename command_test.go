@@ -0,0 +1,295 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	tests := map[string]string{
+		"w":      "write",
+		"wri":    "write",
+		"x":      "xit",
+		"sp":     "split",
+		"vs":     "vsplit",
+		"b":      "buffer",
+		"bn":     "bnext",
+		"tabnew": "tabnew",
+		"se":     "set",
+		"s":      "substitute",
+	}
+	for name, expected := range tests {
+		command := findCommand(name)
+		if command == nil || command.name != expected {
+			t.Fatalf("%s should find %s, found %v", name, expected, command)
+		}
+	}
+
+	for _, name := range []string{"tab", "writ3"} {
+		if command := findCommand(name); command != nil {
+			t.Fatalf("%s should not find a command, found %s", name, command.name)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	settings := Settings{draw: DrawSettings{4}}
+	if _, err := settings.Set("ts=8"); err != nil || settings.draw.tabWidth != 8 {
+		t.Fatalf("tabstop %d, err %v", settings.draw.tabWidth, err)
+	}
+
+	message, err := settings.Set("tabstop?")
+	if err != nil || message != "tabstop=8" {
+		t.Fatalf("unexpected message '%s', err %v", message, err)
+	}
+
+	for _, invalid := range []string{"ts=0", "ts=wide", "notanoption", "nots"} {
+		if _, err = settings.Set(invalid); err == nil {
+			t.Fatalf("%s should fail", invalid)
+		}
+	}
+}
+
+func TestCommandLineHistory(t *testing.T) {
+	var command_line CommandLine
+	for _, command := range []string{"write", "set ts=8", "split"} {
+		command_line.Start()
+		for _, ch := range command {
+			command_line.Insert(ch)
+		}
+		command_line.Finish()
+	}
+
+	// browsing only shows commands starting with what was typed
+	command_line.Start()
+	command_line.Insert('s')
+	command_line.BrowseHistory(-1)
+	if string(command_line.text) != "split" {
+		t.Fatalf("unexpected history entry '%s'", string(command_line.text))
+	}
+	command_line.BrowseHistory(-1)
+	if string(command_line.text) != "set ts=8" {
+		t.Fatalf("unexpected history entry '%s'", string(command_line.text))
+	}
+	command_line.BrowseHistory(-1)
+	if string(command_line.text) != "set ts=8" {
+		t.Fatal("browsing past the oldest match should stay on it")
+	}
+	command_line.BrowseHistory(1)
+	command_line.BrowseHistory(1)
+	if string(command_line.text) != "s" {
+		t.Fatalf("browsing past the newest entry should restore the typed text, got '%s'", string(command_line.text))
+	}
+
+	// editing in the middle of the line
+	command_line.MoveCursor(-1)
+	command_line.Insert(':')
+	command_line.MoveCursor(1)
+	command_line.Insert('p')
+	if string(command_line.text) != ":sp" {
+		t.Fatalf("unexpected text '%s'", string(command_line.text))
+	}
+	command_line.DeleteWord()
+	if len(command_line.text) != 0 {
+		t.Fatalf("unexpected text '%s' after deleting a word", string(command_line.text))
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	var command_line CommandLine
+	command_line.Start()
+	command_line.Insert('w')
+	command_line.Finish()
+	for _, pattern := range []string{"foo", "bar"} {
+		command_line.Search("/", func(string) error { return nil })
+		for _, ch := range pattern {
+			command_line.Insert(ch)
+		}
+		command_line.Finish()
+	}
+	if len(command_line.history) != 1 || len(command_line.search_history) != 2 {
+		t.Fatalf("unexpected histories %v and %v", command_line.history, command_line.search_history)
+	}
+
+	command_line.Search("?", func(string) error { return nil })
+	command_line.BrowseHistory(-1)
+	command_line.BrowseHistory(-1)
+	if string(command_line.text) != "foo" {
+		t.Fatalf("unexpected search history entry '%s'", string(command_line.text))
+	}
+}
+
+// an editor showing a buffer with contents, with the cursor on the given line
+func newTestEditor(contents string, line int) (*Editor, *View) {
+	var editor Editor
+	editor.vim.init()
+	buffer := newTestBuffer(contents)
+	editor.buffers.Add(buffer, "")
+	editor.tabs.tabs = append(editor.tabs.tabs, NewTabLayout(NewViewLayout(buffer)))
+	view := editor.SelectedView()
+	view.cursor = Point{0, line}
+	view.Activate()
+	return &editor, view
+}
+
+// run an ex command with the view's cursor loaded into its buffer, like the
+// editor does
+func runTestCommand(editor *Editor, view *View, command string) error {
+	view.Activate()
+	defer view.Deactivate()
+	return RunCommand(editor, command)
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected LineRange
+		rest     string
+	}{
+		{"s/a/b/", LineRange{2, 2, false}, "s/a/b/"},
+		{"%s", LineRange{0, 5, true}, "s"},
+		{".s", LineRange{2, 2, true}, "s"},
+		{"$d", LineRange{5, 5, true}, "d"},
+		{"2,4d", LineRange{1, 3, true}, "d"},
+		{"4,2d", LineRange{1, 3, true}, "d"},
+		{".,+2s", LineRange{2, 4, true}, "s"},
+		{".-1,$-1s", LineRange{1, 4, true}, "s"},
+		{"+", LineRange{3, 3, true}, ""},
+		{"2;+2", LineRange{1, 3, true}, ""},
+		{" 3 , 5 d", LineRange{2, 4, true}, " d"},
+	}
+	for _, test := range tests {
+		editor, view := newTestEditor("1\n2\n3\n4\n5\n6", 2)
+		lines, rest, err := parseRange(editor, view, test.command)
+		if err != nil || lines != test.expected || rest != test.rest {
+			t.Errorf("%q parsed as %v %q, err %v, expected %v %q", test.command, lines, rest, err, test.expected, test.rest)
+		}
+	}
+
+	for _, invalid := range []string{"7d", "0,2d", ".,+5d", "'<d", "'ad"} {
+		editor, view := newTestEditor("1\n2\n3\n4\n5\n6", 2)
+		if _, _, err := parseRange(editor, view, invalid); err == nil {
+			t.Errorf("%q should fail", invalid)
+		}
+	}
+
+	// the marks are the lines of the last selection
+	editor, view := newTestEditor("1\n2\n3\n4\n5\n6", 1)
+	view.Activate()
+	handleKeys(t, &editor.vim, view.buffer, "Vjj\x1bgg")
+	view.Deactivate()
+	lines, _, err := parseRange(editor, view, "'<,'>s")
+	if err != nil || lines != (LineRange{1, 3, true}) {
+		t.Fatalf("'<,'> parsed as %v, err %v", lines, err)
+	}
+}
+
+func TestGoToLine(t *testing.T) {
+	editor, view := newTestEditor("1\n  2\n3", 0)
+	if err := runTestCommand(editor, view, "2"); err != nil || view.Cursor() != (Point{2, 1}) {
+		t.Fatalf(":2 moved the cursor to %v, err %v", view.Cursor(), err)
+	}
+	if err := runTestCommand(editor, view, "2ls"); err == nil {
+		t.Fatal("a range should not be allowed before ls")
+	}
+}
+
+func TestWriteQuitScratchBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, command := range []string{"wq", "x"} {
+		editor, view := newTestEditor("unnamed", 0)
+		undoer := view.buffer.(Undoer)
+		undoer.StartChange()
+		undoer.SetLine(0, "scratch")
+		undoer.Commit()
+		command_line := &editor.command_line
+		typeCommandLine := func(text string) {
+			for _, ch := range text {
+				command_line.Insert(ch)
+			}
+			editor.FinishCommandLine()
+		}
+
+		command_line.Start()
+		typeCommandLine(command)
+		if !command_line.active || editor.quit {
+			t.Fatalf(":%s on a scratch buffer should ask for a file name", command)
+		}
+		// an empty name asks again
+		typeCommandLine("")
+		if !command_line.active || editor.quit {
+			t.Fatalf(":%s should ask again after an empty file name", command)
+		}
+
+		path := filepath.Join(dir, command)
+		typeCommandLine(path)
+		if !editor.quit {
+			t.Fatalf(":%s should quit once the buffer is saved", command)
+		}
+		if saved, err := ioutil.ReadFile(path); err != nil || string(saved) != "scratch" {
+			t.Fatalf(":%s saved %q, err %v", command, saved, err)
+		}
+	}
+}
+
+func TestQuitView(t *testing.T) {
+	editor, view := newTestEditor("a", 0)
+	countViews := func() (views int) {
+		editor.ForEachView(func(*View) { views++ })
+		return
+	}
+	// splits find the selected view by where it is on the terminal
+	editor.tabs.CalculateRect(Rect{0, 0, 80, 24})
+
+	// :q closes a split, then a tab, before it exits the editor
+	if err := runTestCommand(editor, view, "sp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runTestCommand(editor, editor.SelectedView(), "tabnew"); err != nil {
+		t.Fatal(err)
+	}
+	for views := 3; views > 1; views-- {
+		if err := runTestCommand(editor, editor.SelectedView(), "q"); err != nil {
+			t.Fatal(err)
+		}
+		if editor.quit || countViews() != views-1 {
+			t.Fatalf("%d views, quit %v after :q with %d views", countViews(), editor.quit, views)
+		}
+	}
+	if len(editor.tabs.tabs) != 1 {
+		t.Fatalf("%d tabs left after closing the new tab", len(editor.tabs.tabs))
+	}
+
+	// a modified buffer isn't closed unless another view still shows it
+	undoer := editor.SelectedView().buffer.(Undoer)
+	undoer.StartChange()
+	undoer.SetLine(0, "b")
+	undoer.Commit()
+	runTestCommand(editor, editor.SelectedView(), "sp")
+	if err := runTestCommand(editor, editor.SelectedView(), "q"); err != nil || countViews() != 1 {
+		t.Fatalf("%d views after :q on a buffer shown twice, err %v", countViews(), err)
+	}
+	runTestCommand(editor, editor.SelectedView(), "tabnew")
+	runTestCommand(editor, editor.SelectedView(), "tabprevious")
+	if err := runTestCommand(editor, editor.SelectedView(), "q"); err == nil || countViews() != 2 {
+		t.Fatalf("%d views after :q on a modified buffer, err %v", countViews(), err)
+	}
+	if err := runTestCommand(editor, editor.SelectedView(), "q!"); err != nil || countViews() != 1 || editor.quit {
+		t.Fatalf("%d views, quit %v after :q!, err %v", countViews(), editor.quit, err)
+	}
+
+	// the last view exits, but not while a hidden buffer has unsaved changes
+	if err := runTestCommand(editor, editor.SelectedView(), "q"); err == nil || editor.quit {
+		t.Fatalf("quit %v after :q with a modified hidden buffer, err %v", editor.quit, err)
+	}
+	if err := runTestCommand(editor, editor.SelectedView(), "q!"); err != nil || !editor.quit {
+		t.Fatalf("quit %v after :q! in the last view, err %v", editor.quit, err)
+	}
+}
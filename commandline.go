@@ -0,0 +1,298 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the command line collects an ex command typed after ':' on the status row. it
+// is also used to ask the user a question, in which case the response is
+// handed to a callback instead of being run as a command
+type CommandLine struct {
+	active   bool
+	prompt   string
+	text     []rune
+	cursor   int
+	callback func(response string) error
+	// set when the response is the pattern of a search
+	searching bool
+
+	// output of the last command, shown until the next key is pressed
+	message  string
+	is_error bool
+
+	// previously run commands, oldest first. while browsing, history_index is
+	// the entry being shown and history_draft what was typed before browsing
+	history       []string
+	history_index int
+	history_draft string
+	// previous search patterns, which are browsed while searching
+	search_history []string
+
+	// candidates cycled through by repeatedly pressing tab
+	completions      []string
+	completion_index int
+}
+
+// returns the ways the text typed so far could be completed
+type CompleteFunc func(text string) []string
+
+func (command_line *CommandLine) Start() {
+	command_line.Prompt(":", nil)
+}
+
+// ask the user for a response, callback is called with it once they finish
+func (command_line *CommandLine) Prompt(prompt string, callback func(response string) error) {
+	command_line.active = true
+	command_line.prompt = prompt
+	command_line.callback = callback
+	command_line.setText("")
+	command_line.history_index = len(command_line.history)
+}
+
+// ask for the pattern of a search, with the previous patterns as history
+func (command_line *CommandLine) Search(prompt string, callback func(response string) error) {
+	command_line.Prompt(prompt, callback)
+	command_line.searching = true
+	command_line.history_index = len(command_line.search_history)
+}
+
+func (command_line *CommandLine) Cancel() {
+	command_line.active = false
+	command_line.prompt = ""
+	command_line.callback = nil
+	command_line.searching = false
+	command_line.setText("")
+}
+
+// finish editing and return what was typed along with the callback waiting
+// for it, which is nil for ex commands. ex commands and searches are added to
+// their history
+func (command_line *CommandLine) Finish() (string, func(response string) error) {
+	command, callback := string(command_line.text), command_line.callback
+	if (callback == nil || command_line.searching) && strings.TrimSpace(command) != "" {
+		history := command_line.currentHistory()
+		last := len(*history) - 1
+		if last < 0 || (*history)[last] != command {
+			*history = append(*history, command)
+		}
+	}
+	command_line.Cancel()
+	return command, callback
+}
+
+// the history of searches while searching, otherwise of ex commands
+func (command_line *CommandLine) currentHistory() *[]string {
+	if command_line.searching {
+		return &command_line.search_history
+	}
+	return &command_line.history
+}
+
+func (command_line *CommandLine) setText(text string) {
+	command_line.text = []rune(text)
+	command_line.cursor = len(command_line.text)
+	command_line.completions = nil
+}
+
+func (command_line *CommandLine) Insert(ch rune) {
+	text := append([]rune{}, command_line.text[:command_line.cursor]...)
+	text = append(text, ch)
+	command_line.text = append(text, command_line.text[command_line.cursor:]...)
+	command_line.cursor++
+}
+
+// delete the character before the cursor, backspacing over an empty command
+// line leaves it
+func (command_line *CommandLine) Backspace() {
+	if len(command_line.text) == 0 {
+		command_line.Cancel()
+		return
+	}
+	if command_line.cursor > 0 {
+		command_line.deleteRange(command_line.cursor-1, command_line.cursor)
+	}
+}
+
+// delete the character under the cursor
+func (command_line *CommandLine) Delete() {
+	if command_line.cursor < len(command_line.text) {
+		command_line.deleteRange(command_line.cursor, command_line.cursor+1)
+	}
+}
+
+// delete the word before the cursor
+func (command_line *CommandLine) DeleteWord() {
+	start := command_line.cursor
+	for start > 0 && unicode.IsSpace(command_line.text[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(command_line.text[start-1]) {
+		start--
+	}
+	command_line.deleteRange(start, command_line.cursor)
+}
+
+// delete everything before the cursor
+func (command_line *CommandLine) DeleteToStart() {
+	command_line.deleteRange(0, command_line.cursor)
+}
+
+func (command_line *CommandLine) deleteRange(start int, end int) {
+	command_line.text = append(command_line.text[:start], command_line.text[end:]...)
+	command_line.cursor = start
+}
+
+func (command_line *CommandLine) MoveCursor(delta int) {
+	command_line.cursor = Clamp(command_line.cursor+delta, 0, len(command_line.text))
+}
+
+// show the previous (direction -1) or next (direction 1) command in the
+// history which starts with what was typed before browsing
+func (command_line *CommandLine) BrowseHistory(direction int) {
+	history := *command_line.currentHistory()
+	if command_line.history_index == len(history) {
+		command_line.history_draft = string(command_line.text)
+	}
+
+	for i := command_line.history_index + direction; i >= 0 && i <= len(history); i += direction {
+		if i == len(history) {
+			command_line.history_index = i
+			command_line.setText(command_line.history_draft)
+			return
+		}
+		if strings.HasPrefix(history[i], command_line.history_draft) {
+			command_line.history_index = i
+			command_line.setText(history[i])
+			return
+		}
+	}
+}
+
+// replace the text with the next way it could be completed. the first tab
+// asks complete for the candidates, later tabs cycle through them
+func (command_line *CommandLine) Complete(complete CompleteFunc) {
+	if command_line.completions == nil {
+		completions := complete(string(command_line.text))
+		if len(completions) == 0 {
+			return
+		}
+		// cycling back round to the start restores what was typed
+		command_line.completions = append(completions, string(command_line.text))
+		command_line.completion_index = -1
+	}
+
+	completions := command_line.completions
+	command_line.completion_index = (command_line.completion_index + 1) % len(completions)
+	command_line.text = []rune(completions[command_line.completion_index])
+	command_line.cursor = len(command_line.text)
+}
+
+// edit the command line with a key. returns true when enter is pressed and
+// the command line should be finished
+func (command_line *CommandLine) HandleKey(ev termbox.Event, complete CompleteFunc) bool {
+	if ev.Key != termbox.KeyTab {
+		command_line.completions = nil
+	}
+
+	switch ev.Key {
+	default:
+		if ev.Ch != 0 {
+			command_line.Insert(ev.Ch)
+		}
+	case termbox.KeySpace:
+		command_line.Insert(' ')
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		command_line.Backspace()
+	case termbox.KeyDelete:
+		command_line.Delete()
+	case termbox.KeyCtrlW:
+		command_line.DeleteWord()
+	case termbox.KeyCtrlU:
+		command_line.DeleteToStart()
+	case termbox.KeyArrowLeft:
+		command_line.MoveCursor(-1)
+	case termbox.KeyArrowRight:
+		command_line.MoveCursor(1)
+	case termbox.KeyHome, termbox.KeyCtrlB:
+		command_line.MoveCursor(-len(command_line.text))
+	case termbox.KeyEnd, termbox.KeyCtrlE:
+		command_line.MoveCursor(len(command_line.text))
+	case termbox.KeyArrowUp:
+		if command_line.callback == nil || command_line.searching {
+			command_line.BrowseHistory(-1)
+		}
+	case termbox.KeyArrowDown:
+		if command_line.callback == nil || command_line.searching {
+			command_line.BrowseHistory(1)
+		}
+	case termbox.KeyTab:
+		if command_line.callback == nil && complete != nil {
+			command_line.Complete(complete)
+		}
+	case termbox.KeyEsc, termbox.KeyCtrlC:
+		command_line.Cancel()
+	case termbox.KeyEnter:
+		return true
+	}
+	return false
+}
+
+func (command_line *CommandLine) ShowMessage(message string) {
+	command_line.message = message
+	command_line.is_error = false
+}
+
+func (command_line *CommandLine) ShowError(err error) {
+	command_line.message = err.Error()
+	command_line.is_error = true
+}
+
+func (command_line *CommandLine) ClearMessage() {
+	command_line.message = ""
+	command_line.is_error = false
+}
+
+// draw the command line over the given terminal row and place the cursor in
+// it. when it isn't active any message is drawn instead, growing upwards from
+// the row if it has several lines
+func (command_line *CommandLine) Draw(row int, terminal_dimensions Point) {
+	if !command_line.active {
+		fg := termbox.ColorDefault
+		if command_line.is_error {
+			fg = termbox.ColorRed | termbox.AttrBold
+		}
+
+		lines := strings.Split(command_line.message, "\n")
+		for i, line := range lines {
+			drawLine(row-len(lines)+1+i, line, fg, terminal_dimensions)
+		}
+		return
+	}
+
+	drawLine(row, command_line.prompt+string(command_line.text), termbox.ColorDefault, terminal_dimensions)
+	cursor := utf8.RuneCountInString(command_line.prompt) + command_line.cursor
+	termbox.SetCursor(Clamp(cursor, 0, terminal_dimensions.x-1), row)
+}
+
+// clear a terminal row and draw text on it
+func drawLine(row int, text string, fg termbox.Attribute, terminal_dimensions Point) {
+	if row < 0 {
+		return
+	}
+
+	for x := 0; x < terminal_dimensions.x; x++ {
+		termbox.SetCell(x, row, ' ', termbox.ColorDefault, termbox.ColorDefault)
+	}
+
+	x := 0
+	for _, ch := range text {
+		if x >= terminal_dimensions.x {
+			break
+		}
+		termbox.SetCell(x, row, ch, fg, termbox.ColorDefault)
+		x++
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+type Compression int
+
+const (
+	COMPRESSION_NONE Compression = iota
+	COMPRESSION_GZIP
+	COMPRESSION_BZIP2
+	COMPRESSION_XZ
+)
+
+// returned when saving a file in a compression format we have no encoder for
+var ErrUnsupportedCompression = errors.New("no encoder available for the file's compression")
+
+// magic bytes found at the start of compressed files
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+	// when set, the byte after the magic must be one of these
+	followedBy string
+}{
+	{COMPRESSION_GZIP, []byte{0x1f, 0x8b}, ""},
+	// bzip2's magic is short enough to start plain text, so the block size
+	// after it is checked too
+	{COMPRESSION_BZIP2, []byte("BZh"), "123456789"},
+	{COMPRESSION_XZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, ""},
+}
+
+func (compression Compression) String() string {
+	switch compression {
+	case COMPRESSION_GZIP:
+		return "gzip"
+	case COMPRESSION_BZIP2:
+		return "bzip2"
+	case COMPRESSION_XZ:
+		return "xz"
+	}
+	return "none"
+}
+
+// figure out how the data in reader is compressed by looking at its first few
+// bytes rather than trusting a file suffix. the returned reader yields all of
+// the data, including the bytes we peeked at
+func DetectCompression(reader io.Reader) (Compression, io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	header, err := buffered.Peek(6)
+	if err != nil && err != io.EOF {
+		return COMPRESSION_NONE, buffered, err
+	}
+
+	for _, candidate := range compressionMagic {
+		if !bytes.HasPrefix(header, candidate.magic) {
+			continue
+		}
+		if candidate.followedBy != "" {
+			size := len(candidate.magic)
+			if len(header) <= size || strings.IndexByte(candidate.followedBy, header[size]) < 0 {
+				continue
+			}
+		}
+		return candidate.compression, buffered, nil
+	}
+	return COMPRESSION_NONE, buffered, nil
+}
+
+// wrap reader so that reading from it decompresses the data
+func NewDecompressor(reader io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case COMPRESSION_GZIP:
+		return gzip.NewReader(reader)
+	case COMPRESSION_BZIP2:
+		return ioutil.NopCloser(bzip2.NewReader(reader)), nil
+	case COMPRESSION_XZ:
+		return newCommandReader(reader, "xz", "--decompress", "--stdout")
+	}
+	return ioutil.NopCloser(reader), nil
+}
+
+// wrap writer so that writing to it compresses the data. the data is not
+// completely written until the returned writer is closed
+func NewCompressor(writer io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case COMPRESSION_GZIP:
+		return gzip.NewWriter(writer), nil
+	case COMPRESSION_BZIP2:
+		// the standard library can only decompress bzip2
+		return newCommandWriter(writer, "bzip2", "--compress", "--stdout")
+	case COMPRESSION_XZ:
+		return newCommandWriter(writer, "xz", "--compress", "--stdout")
+	}
+	return nopWriteCloser{writer}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// reads the output of a command that is fed the input reader
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func newCommandReader(input io.Reader, name string, args ...string) (io.ReadCloser, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, errors.New("reading this file requires " + name)
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = input
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{output, cmd}, nil
+}
+
+func (reader *commandReader) Close() error {
+	reader.ReadCloser.Close()
+	return reader.cmd.Wait()
+}
+
+// feeds everything written to a command which writes its output to writer
+type commandWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func newCommandWriter(output io.Writer, name string, args ...string) (io.WriteCloser, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, ErrUnsupportedCompression
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = output
+	input, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandWriter{input, cmd}, nil
+}
+
+func (writer *commandWriter) Close() error {
+	if err := writer.WriteCloser.Close(); err != nil {
+		writer.cmd.Wait()
+		return err
+	}
+	return writer.cmd.Wait()
+}
@@ -6,6 +6,7 @@ import (
 	"go/scanner"
 	"go/token"
 	"go/types"
+	"regexp"
 	"unicode/utf8"
 	//"log"
 )
@@ -154,7 +155,9 @@ func (syntax *GoSyntax) Highlight(point Point) (termbox.Attribute, termbox.Attri
 	return syntax.Colors[point.y][point.x].fg, syntax.Colors[point.y][point.x].bg
 }
 
-func DrawBuffer(buffer Buffer, view Rect, scroll Point, terminal_dimensions Point, settings *DrawSettings) (err error) {
+// draw the visible part of a buffer, with any selected text in reverse video
+// and matches of highlight in black on yellow
+func DrawBuffer(buffer Buffer, view Rect, scroll Point, terminal_dimensions Point, settings *DrawSettings, selection *Selection, highlight *regexp.Regexp) (err error) {
 	last_row := scroll.y + view.Height()
 	if last_row > len(buffer.Lines()) {
 		last_row = len(buffer.Lines())
@@ -173,8 +176,21 @@ func DrawBuffer(buffer Buffer, view Rect, scroll Point, terminal_dimensions Poin
 
 		line := []rune(lineBytes)
 
-		var lineWidth, printedWidth int
+		// an empty line shows it is selected with a single cell
+		if len(line) == 0 && scroll.x == 0 && selection.Contains(Point{0, scroll.y + y}, 0) {
+			termbox.SetCell(view.left, final_y, ' ', termbox.ColorDefault|termbox.AttrReverse, termbox.ColorDefault)
+		}
+
+		var matches [][]int
+		if highlight != nil {
+			matches = highlight.FindAllStringIndex(lineBytes, -1)
+		}
+
+		var lineWidth, printedWidth, byte_x int
 		for column, ch := range line {
+			x := byte_x
+			byte_x += utf8.RuneLen(ch)
+
 			if printedWidth >= view.Width() {
 				break
 			}
@@ -187,6 +203,12 @@ func DrawBuffer(buffer Buffer, view Rect, scroll Point, terminal_dimensions Poin
 			lineWidth += printLen(ch, settings)
 			if lineWidth > scroll.x {
 				fgColor, bgColor := syntax.Highlight(Point{x: column, y: scroll.y + y})
+				if inMatch(matches, x) {
+					fgColor, bgColor = termbox.ColorBlack, termbox.ColorYellow
+				}
+				if selection.Contains(Point{x, scroll.y + y}, column) {
+					fgColor |= termbox.AttrReverse
+				}
 				termbox.SetCell(final_x, final_y, ch, fgColor, bgColor)
 				printedWidth = lineWidth - scroll.x
 			}
@@ -194,3 +216,13 @@ func DrawBuffer(buffer Buffer, view Rect, scroll Point, terminal_dimensions Poin
 	}
 	return
 }
+
+// returns true if the byte at x is inside one of the matches
+func inMatch(matches [][]int, x int) bool {
+	for _, match := range matches {
+		if x >= match[0] && x < match[1] {
+			return true
+		}
+	}
+	return false
+}
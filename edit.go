@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // convenience functions for editing using the basic buffer interface
@@ -39,6 +40,14 @@ func Load(buffer Buffer, reader io.Reader) (err error) {
 			log.Fatalf("io.Copy() error: %v", err)
 		}
 	}
+
+	// a buffer always has a line for the cursor to be on, even when nothing
+	// was loaded
+	if len(buffer.Lines()) == 0 {
+		if insert_err := buffer.InsertLine(0, ""); err == nil {
+			err = insert_err
+		}
+	}
 	return
 }
 
@@ -114,6 +123,64 @@ func Join(buffer Buffer, lineIndex int) (err error) {
 	return
 }
 
+// split the line at location, moving everything from location onwards to a
+// new line below it
+func SplitLine(buffer Buffer, location Point) (err error) {
+	undoer, ok := buffer.(Undoer)
+	if ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+	if location.y < 0 || location.y >= len(buffer.Lines()) {
+		return errors.New(fmt.Sprintf("Invalid Point %v", location))
+	}
+
+	line := buffer.Lines()[location.y]
+	if location.x < 0 || location.x > len(line) {
+		return errors.New(fmt.Sprintf("Invalid Point %v", location))
+	}
+
+	if err = buffer.SetLine(location.y, line[:location.x]); err != nil {
+		return
+	}
+	return buffer.InsertLine(location.y+1, line[location.x:])
+}
+
+// delete the character before location. at the start of a line the line is
+// joined to the end of the previous line without trimming anything. returns
+// where the deleted character was, which is where a cursor at location ends up
+func Backspace(buffer Buffer, location Point) (p Point, err error) {
+	undoer, ok := buffer.(Undoer)
+	if ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+	if location.y < 0 || location.y >= len(buffer.Lines()) {
+		return location, errors.New(fmt.Sprintf("Invalid Point %v", location))
+	}
+
+	line := buffer.Lines()[location.y]
+	if location.x < 0 || location.x > len(line) {
+		return location, errors.New(fmt.Sprintf("Invalid Point %v", location))
+	}
+
+	if location.x == 0 {
+		if location.y == 0 {
+			// nothing before the start of the buffer
+			return location, nil
+		}
+		previous := buffer.Lines()[location.y-1]
+		if err = buffer.SetLine(location.y-1, previous+line); err != nil {
+			return location, err
+		}
+		return Point{len(previous), location.y - 1}, buffer.DeleteLine(location.y)
+	}
+
+	_, size := utf8.DecodeLastRuneInString(line[:location.x])
+	p = Point{location.x - size, location.y}
+	return p, buffer.SetLine(location.y, line[:p.x]+line[location.x:])
+}
+
 func DeleteLine(buffer Buffer, lineIndex int) error {
 	undoer, ok := buffer.(Undoer)
 	if ok {
@@ -161,7 +228,7 @@ func ClampOn(buffer Buffer, point Point) (p Point) {
 // clamp point to point to a character on the buffer
 func ClampIn(buffer Buffer, point Point) (p Point) {
 	p.y = Clamp(point.y, 0, len(buffer.Lines())-1)
-	p.x = Clamp(point.x, 0, len(buffer.Lines()[p.y])-1)
+	p.x = Clamp(point.x, 0, stringLastIndex(buffer.Lines()[p.y]))
 	return
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -47,3 +48,26 @@ func TestDirectoryLoad(t *testing.T) {
 		}
 	}
 }
+
+func TestEmptyLoad(t *testing.T) {
+	// piping nothing into ge - gives an empty buffer
+	_, buffer, err := loadCompressed(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buffer.Lines()) != 1 || buffer.Lines()[0] != "" {
+		t.Fatalf("expected one empty line, got %q", buffer.Lines())
+	}
+
+	var vim Vim
+	vim.init()
+	// moving and editing where there is nothing shouldn't panic, whether or
+	// not the keys fail
+	for _, key := range "wddJ/x\rn" {
+		vim.HandleKey(key, buffer)
+	}
+	handleKeys(t, &vim, buffer, "ihello\x1b")
+	if StringifyBuffer(buffer) != "hello\n" {
+		t.Fatalf("unexpected buffer %q", StringifyBuffer(buffer))
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// the editor ties together the loaded buffers, the tabs of layouts showing
+// them and the command line, which is everything ex commands work on
+type Editor struct {
+	buffers      BufferList
+	tabs         TabListLayout
+	command_line CommandLine
+	settings     Settings
+	vim          Vim
+	// a substitution waiting for each match to be confirmed, and the last
+	// substitution, which :s without a pattern repeats
+	substitution    *substitution
+	last_substitute substituteArgs
+	// set while :g runs a command on each line, which can't run :g again
+	in_global bool
+	// set by commands which exit the editor
+	quit bool
+}
+
+// create an empty buffer with no file name, it asks for one when first saved
+func NewScratchBuffer() Buffer {
+	return NewUndoer(&BaseBuffer{lines: []string{""}})
+}
+
+func (editor *Editor) CurrentTab() *TabLayout {
+	return &editor.tabs.tabs[editor.tabs.selection]
+}
+
+// the view being edited, nil when a list layout is selected
+func (editor *Editor) SelectedView() *View {
+	view_layout, is_view_layout := editor.CurrentTab().selection.(*ViewLayout)
+	if !is_view_layout {
+		return nil
+	}
+	return &view_layout.view
+}
+
+// call f with every view in every tab
+func (editor *Editor) ForEachView(f func(view *View)) {
+	for i := range editor.tabs.tabs {
+		forEachView(editor.tabs.tabs[i].root, f)
+	}
+}
+
+// show the visual mode selection in the selected view, and no selection in
+// any other
+func (editor *Editor) UpdateSelection() {
+	editor.ForEachView(func(view *View) {
+		view.selection = Selection{}
+	})
+	if view := editor.SelectedView(); view != nil && view.buffer != nil {
+		view.selection = editor.vim.Selection(view.buffer, view.Cursor())
+	}
+}
+
+// open the command line for the pattern of a search started in vim. the
+// pattern is handed back to vim as the keys of the search once it is finished
+func (editor *Editor) StartSearch() {
+	prompt := editor.vim.SearchPrompt()
+	if prompt == "" || editor.command_line.active {
+		return
+	}
+	editor.command_line.Search(prompt, func(pattern string) error {
+		view := editor.SelectedView()
+		if view == nil || view.buffer == nil {
+			return errors.New("no view selected")
+		}
+		for _, key := range pattern + string(KEY_ENTER) {
+			if err := editor.vim.HandleKey(key, view.buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// open the command line for an ex command. typed in visual mode, the
+// selection ends and the command starts with the range of its lines
+func (editor *Editor) StartCommandLine() {
+	command_line := &editor.command_line
+	command_line.Start()
+	view := editor.SelectedView()
+	if isVisual(editor.vim.mode) && view != nil && view.buffer != nil {
+		editor.vim.StopVisual(view.buffer)
+		for _, ch := range "'<,'>" {
+			command_line.Insert(ch)
+		}
+	}
+}
+
+// abandon the search being typed when its command line is closed
+func (editor *Editor) CancelSearch() {
+	view := editor.SelectedView()
+	if editor.vim.SearchPrompt() != "" && view != nil && view.buffer != nil {
+		editor.vim.HandleKey(KEY_ESCAPE, view.buffer)
+	}
+}
+
+// highlight the matches of the search being typed in the selected view, and
+// nothing in any other
+func (editor *Editor) UpdateSearchHighlight() {
+	editor.ForEachView(func(view *View) {
+		view.highlight = nil
+	})
+	command_line := &editor.command_line
+	view := editor.SelectedView()
+	if view != nil && editor.substitution != nil {
+		view.highlight = editor.substitution.re
+	}
+	if view == nil || !command_line.active || !command_line.searching {
+		return
+	}
+	pattern := searchPattern(string(command_line.text), []rune(command_line.prompt)[0])
+	if pattern == "" {
+		return
+	}
+	if re, err := CompileSearch(pattern, &editor.settings.search); err == nil {
+		view.highlight = re
+	}
+}
+
+// switch the buffer shown by a view
+func (editor *Editor) ShowBuffer(view *View, buffer Buffer) {
+	if view.buffer == buffer {
+		return
+	}
+	view.SetBuffer(buffer)
+}
+
+// remove a buffer from the editor. views showing it switch to the next buffer
+// in the list, or to a new scratch buffer if it was the last one
+func (editor *Editor) DeleteBuffer(buffer Buffer) {
+	replacement := editor.buffers.Next(buffer, 1)
+	editor.buffers.Remove(buffer)
+	if replacement == buffer || replacement == nil {
+		replacement = NewScratchBuffer()
+		editor.buffers.Add(replacement, "")
+	}
+
+	editor.ForEachView(func(view *View) {
+		if view.buffer == buffer {
+			editor.ShowBuffer(view, replacement)
+		}
+	})
+}
+
+// return the buffer for a file, loading it if it isn't open yet. a file which
+// doesn't exist gets an empty buffer that creates it when saved
+func (editor *Editor) OpenFile(path string) (Buffer, error) {
+	for _, entry := range editor.buffers.entries {
+		if entry.Path() != "" && filepath.Clean(entry.Path()) == filepath.Clean(path) {
+			return entry.buffer, nil
+		}
+	}
+
+	buffer, err := loadFile(path)
+	if os.IsNotExist(err) {
+		buffer, err = NewUndoer(&BaseBuffer{lines: []string{""}, saver: NewFileSaver(path)}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	editor.buffers.Add(buffer, "")
+	return buffer, nil
+}
+
+// split the selected view horizontally (one above the other) or vertically
+// (side by side). the selected view shows the file given in args if there is
+// one, otherwise both views show the same buffer
+func (editor *Editor) SplitView(horizontal bool, args []string) error {
+	var buffer Buffer
+	switch len(args) {
+	case 0:
+	case 1:
+		var err error
+		if buffer, err = editor.OpenFile(args[0]); err != nil {
+			return err
+		}
+	default:
+		return errors.New("too many file names")
+	}
+
+	tab := editor.CurrentTab()
+	tab.PrepareSplit(horizontal)
+	tab.Split()
+
+	if view := editor.SelectedView(); view != nil && buffer != nil {
+		editor.ShowBuffer(view, buffer)
+	}
+	return nil
+}
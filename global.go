@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// :[range]g/pattern/command runs an ex command on every line of the range, the
+// whole buffer by default, which matches the pattern. :g! and :v run it on the
+// lines which don't match. the lines are marked first, then the command is run
+// with the cursor on each marked line in turn. marks follow their lines as the
+// command inserts and deletes lines, and lines it deletes aren't visited.
+// without a command the matching lines are listed. everything the command
+// changes is undone together
+
+// a buffer which keeps lines marked by :g numbered as lines are inserted and
+// deleted through it, dropping the marks of deleted lines
+type markedBuffer struct {
+	Buffer
+	// the marked lines in order, and the index of the next one to visit
+	marks []int
+	next  int
+}
+
+func (buffer *markedBuffer) InsertLine(lineIndex int, toInsert string) (err error) {
+	if err = buffer.Buffer.InsertLine(lineIndex, toInsert); err != nil {
+		return
+	}
+	for i := sort.SearchInts(buffer.marks, lineIndex); i < len(buffer.marks); i++ {
+		buffer.marks[i]++
+	}
+	return
+}
+
+func (buffer *markedBuffer) DeleteLine(lineIndex int) (err error) {
+	if err = buffer.Buffer.DeleteLine(lineIndex); err != nil {
+		return
+	}
+	i := sort.SearchInts(buffer.marks, lineIndex)
+	if i < len(buffer.marks) && buffer.marks[i] == lineIndex {
+		buffer.marks = append(buffer.marks[:i], buffer.marks[i+1:]...)
+		if i < buffer.next {
+			buffer.next--
+		}
+	}
+	for ; i < len(buffer.marks); i++ {
+		buffer.marks[i]--
+	}
+	return
+}
+
+func (buffer *markedBuffer) Clear() (err error) {
+	buffer.marks = nil
+	buffer.next = 0
+	return buffer.Buffer.Clear()
+}
+
+// the next marked line to visit, false once they have all been visited
+func (buffer *markedBuffer) Next() (int, bool) {
+	if buffer.next >= len(buffer.marks) {
+		return 0, false
+	}
+	buffer.next++
+	return buffer.marks[buffer.next-1], true
+}
+
+// call f with the cursor at the start of each of the lines in marks, which
+// are in order. while f runs the view shows a markedBuffer, so the lines are
+// followed as f changes the buffer through the view
+func forEachMarkedLine(view *View, marks []int, f func() error) (err error) {
+	if undoer, ok := view.buffer.(Undoer); ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+
+	marked := &markedBuffer{Buffer: view.buffer, marks: marks}
+	view.buffer = marked
+	defer func() {
+		// unless f showed another buffer in the view
+		if view.buffer == marked {
+			view.buffer = marked.Buffer
+		}
+	}()
+
+	for y, ok := marked.Next(); ok; y, ok = marked.Next() {
+		if err = marked.SetCursor(Point{0, y}); err != nil {
+			return
+		}
+		if err = f(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func globalCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) error {
+	return editor.global(view, lines, arg, !force)
+}
+
+func vglobalCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) error {
+	return editor.global(view, lines, arg, false)
+}
+
+// run the command in arg on the lines of the range which match (or don't
+// match) the pattern in arg
+func (editor *Editor) global(view *View, lines LineRange, arg string, matching bool) error {
+	if editor.in_global {
+		return errors.New("cannot do :global recursively")
+	}
+
+	arg = strings.TrimLeft(arg, " \t")
+	if arg == "" {
+		return errors.New("regular expression missing from :global")
+	}
+	delimiter, rest, err := splitDelimiter(arg)
+	if err != nil {
+		return err
+	}
+	pattern, command := splitDelimited(rest, delimiter)
+
+	vim := &editor.vim
+	if pattern == "" {
+		if pattern = vim.last_search.pattern; pattern == "" {
+			return errors.New("no previous regular expression")
+		}
+	}
+	if vim.last_search.pattern == "" {
+		vim.last_search.forward = true
+	}
+	vim.last_search.pattern = pattern
+
+	re, err := CompileSearch(pattern, &editor.settings.search)
+	if err != nil {
+		return err
+	}
+	if !lines.given {
+		lines = LineRange{0, len(view.buffer.Lines()) - 1, true}
+	}
+	var marks []int
+	for y := lines.start; y <= lines.end; y++ {
+		if re.MatchString(view.buffer.Lines()[y]) == matching {
+			marks = append(marks, y)
+		}
+	}
+	if len(marks) == 0 {
+		if matching {
+			return errors.New("pattern not found: " + pattern)
+		}
+		return errors.New("pattern found in every line: " + pattern)
+	}
+
+	if strings.TrimSpace(command) == "" {
+		var listing []string
+		for _, y := range marks {
+			listing = append(listing, view.buffer.Lines()[y])
+		}
+		editor.command_line.ShowMessage(strings.Join(listing, "\n"))
+		return nil
+	}
+	if register, ok := isPlainDelete(command); ok {
+		return editor.deleteMarkedLines(view.buffer, marks, register)
+	}
+
+	editor.in_global = true
+	defer func() { editor.in_global = false }()
+	return forEachMarkedLine(view, marks, func() error {
+		return RunCommand(editor, command)
+	})
+}
+
+// returns true, with any register it names, if command is :d on its own
+func isPlainDelete(command string) (rune, bool) {
+	name, arg, _ := splitCommandName(command)
+	if name == "" || findCommand(name) == nil || findCommand(name).name != "delete" {
+		return 0, false
+	}
+	register, count, err := registerAndCount(arg)
+	return register, err == nil && count == 0
+}
+
+// delete the marked lines, as :g does with :d, all in one go. deleting them
+// one at a time moves every line below each of them up, which is slow on big
+// buffers like logs, so instead the lines kept are moved up over the deleted
+// lines and what is left over is deleted from the end. the register gets each
+// deleted line in turn, as if they had been deleted one at a time
+func (editor *Editor) deleteMarkedLines(buffer Buffer, marks []int, register rune) (err error) {
+	if undoer, ok := buffer.(Undoer); ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+
+	lines := buffer.Lines()
+	kept := marks[0]
+	for y, next := marks[0], 0; y < len(lines); y++ {
+		if next < len(marks) && marks[next] == y {
+			next++
+			deleted := Register{lines: []string{lines[y]}, linewise: true}
+			if err = editor.vim.registers.Delete(register, deleted); err != nil {
+				return
+			}
+			continue
+		}
+		if err = buffer.SetLine(kept, lines[y]); err != nil {
+			return
+		}
+		kept++
+	}
+	for y := len(lines) - 1; y >= kept; y-- {
+		if err = buffer.DeleteLine(y); err != nil {
+			return
+		}
+	}
+	// a buffer always has a line to put the cursor on
+	if len(buffer.Lines()) == 0 {
+		if err = buffer.InsertLine(0, ""); err != nil {
+			return
+		}
+	}
+
+	// the cursor goes to the line after the last deleted line, like it would
+	// deleting them one at a time
+	y := Clamp(marks[len(marks)-1]-len(marks)+1, 0, len(buffer.Lines())-1)
+	return buffer.SetCursor(Point{firstNonBlank(buffer.Lines()[y]), y})
+}
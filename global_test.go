@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGlobal(t *testing.T) {
+	tests := []struct {
+		contents string
+		command  string
+		expected string
+	}{
+		{"DEBUG a\nINFO b\nDEBUG c\nWARN d", "g/DEBUG/d", "INFO b\nWARN d"},
+		{"DEBUG a\nINFO b\nDEBUG c\nWARN d", "v/DEBUG/d", "DEBUG a\nDEBUG c"},
+		{"DEBUG a\nINFO b\nDEBUG c\nWARN d", "g!/DEBUG/d", "DEBUG a\nDEBUG c"},
+		{"DEBUG a\nDEBUG b", "g/DEBUG/d", ""},
+		{"x\nx\ny\nx", "2,$g/x/d", "x\ny"},
+		{"a 1\nb 2\na 3", "g/^a/s/\\d/N/", "a N\nb 2\na N"},
+		{"a\nb\nc", "g/^/m0", "c\nb\na"},
+		{"a\nb", "g/./t.", "a\na\nb\nb"},
+		{"a\nb", "g/./normal Ax", "ax\nbx"},
+		{"start\nx\nx\nend", "g/x/.,+1d", "start\nend"},
+		{"x1\nx2\ny\nx3\nz", "g/x/normal jdd", "x1\ny\nx3"},
+		{"a,b\nc", "g/,/s/,/\\r/", "a\nb\nc"},
+		{"a\nfoo\nb\nfoo", "g#foo#normal Obar", "a\nbar\nfoo\nb\nbar\nfoo"},
+	}
+	for _, test := range tests {
+		editor, view := newTestEditor(test.contents, 0)
+		if err := runTestCommand(editor, view, test.command); err != nil {
+			t.Errorf("%q on %q: %v", test.command, test.contents, err)
+			continue
+		}
+		if StringifyBuffer(view.buffer) != test.expected+"\n" {
+			t.Errorf("%q after %q on %q, expected %q", StringifyBuffer(view.buffer), test.command, test.contents, test.expected)
+		}
+		if _, marked := view.buffer.(*markedBuffer); marked || editor.in_global {
+			t.Errorf("still running :global after %q", test.command)
+		}
+
+		view.Activate()
+		view.buffer.(Undoer).Undo()
+		if StringifyBuffer(view.buffer) != test.contents+"\n" {
+			t.Errorf("%q after undoing %q", StringifyBuffer(view.buffer), test.command)
+		}
+	}
+
+	for _, invalid := range []string{"g/z/d", "v/./d", "g", "g/a/g/a/d", "g/a/s/a/b/c"} {
+		editor, view := newTestEditor("a\nb", 0)
+		if err := runTestCommand(editor, view, invalid); err == nil {
+			t.Errorf("%q should fail", invalid)
+		}
+	}
+}
+
+func TestGlobalList(t *testing.T) {
+	editor, view := newTestEditor("DEBUG a\nINFO b\nDEBUG c", 0)
+	if err := runTestCommand(editor, view, "g/DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	if editor.command_line.message != "DEBUG a\nDEBUG c" {
+		t.Fatalf("unexpected listing %q", editor.command_line.message)
+	}
+}
+
+func TestGlobalDeleteLarge(t *testing.T) {
+	lines := make([]string, 200000)
+	var kept []string
+	for i := range lines {
+		lines[i] = fmt.Sprintf("INFO %d", i)
+		if i%3 != 0 {
+			lines[i] = fmt.Sprintf("DEBUG %d", i)
+			continue
+		}
+		kept = append(kept, lines[i])
+	}
+	editor, view := newTestEditor(strings.Join(lines, "\n"), 0)
+	if err := runTestCommand(editor, view, "g/DEBUG/d"); err != nil {
+		t.Fatal(err)
+	}
+	if StringifyBuffer(view.buffer) != strings.Join(kept, "\n")+"\n" {
+		t.Fatal("unexpected lines left")
+	}
+	if view.Cursor() != (Point{0, len(kept) - 1}) {
+		t.Fatalf("unexpected cursor %v", view.Cursor())
+	}
+
+	// the unnamed register holds the last line deleted
+	register, err := editor.vim.registers.Get(0)
+	if err != nil || register.String() != "DEBUG 199999\n" {
+		t.Fatalf("unexpected register %q, err %v", register.String(), err)
+	}
+}
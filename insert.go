@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// insert mode sends typed text straight into the buffer until escape returns
+// to normal mode. everything done in one insert is a single change for undo.
+// the keys typed are kept so a count, or ., can type them again. replace mode
+// works the same way, except typed text overwrites what is under the cursor
+
+// returns true in the modes where typed keys go into the buffer
+func isInserting(mode Mode) bool {
+	return mode == MODE_INSERT || mode == MODE_REPLACE
+}
+
+func (vim *Vim) startInsert(action *Action, buffer Buffer) {
+	vim.insert_action = *action
+	vim.inserted = nil
+	vim.replaced = nil
+	if undoer, ok := buffer.(Undoer); ok && vim.insert_change == nil {
+		undoer.StartChange()
+		vim.insert_change = undoer
+	}
+}
+
+// insert text at the cursor, or overwrite the text there in replace mode, and
+// move the cursor after it
+func (vim *Vim) InsertText(buffer Buffer, text string) (err error) {
+	vim.inserted = append(vim.inserted, []rune(text)...)
+	if vim.mode == MODE_REPLACE {
+		return vim.replaceText(buffer, text)
+	}
+
+	cursor := buffer.Cursor()
+	if err = Insert(buffer, cursor, text); err != nil {
+		return
+	}
+	return buffer.SetCursor(Point{cursor.x + len(text), cursor.y})
+}
+
+// overwrite a character under the cursor for each one in text, keeping what
+// was there for backspace. past the end of the line text is added instead
+func (vim *Vim) replaceText(buffer Buffer, text string) (err error) {
+	for _, ch := range text {
+		cursor := buffer.Cursor()
+		line := buffer.Lines()[cursor.y]
+		original := ""
+		if cursor.x < len(line) {
+			_, size := utf8.DecodeRuneInString(line[cursor.x:])
+			original = line[cursor.x : cursor.x+size]
+		}
+
+		if err = SetLine(buffer, cursor.y, line[:cursor.x]+string(ch)+line[cursor.x+len(original):]); err != nil {
+			return
+		}
+		vim.replaced = append(vim.replaced, original)
+		if err = buffer.SetCursor(Point{cursor.x + utf8.RuneLen(ch), cursor.y}); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// split the line at the cursor and move the cursor to the start of the new line
+func (vim *Vim) InsertNewline(buffer Buffer) (err error) {
+	cursor := buffer.Cursor()
+	if err = SplitLine(buffer, cursor); err != nil {
+		return
+	}
+	vim.inserted = append(vim.inserted, '\n')
+	if vim.mode == MODE_REPLACE {
+		vim.replaced = append(vim.replaced, "\n")
+	}
+	return buffer.SetCursor(Point{0, cursor.y + 1})
+}
+
+// delete the character before the cursor, joining lines at the start of a
+// line. in replace mode the character overwritten there is put back
+func (vim *Vim) InsertBackspace(buffer Buffer) (err error) {
+	vim.inserted = append(vim.inserted, '\b')
+	if vim.mode == MODE_REPLACE {
+		return vim.restoreReplaced(buffer)
+	}
+
+	cursor, err := Backspace(buffer, buffer.Cursor())
+	if err != nil {
+		return
+	}
+	return buffer.SetCursor(cursor)
+}
+
+// undo the last character typed in replace mode. before the first, backspace
+// only moves the cursor back over the text, like vim does
+func (vim *Vim) restoreReplaced(buffer Buffer) (err error) {
+	cursor := buffer.Cursor()
+	if len(vim.replaced) == 0 {
+		if cursor.x > 0 {
+			cursor, _ = prevPoint(buffer, cursor)
+		}
+		return buffer.SetCursor(cursor)
+	}
+
+	original := vim.replaced[len(vim.replaced)-1]
+	vim.replaced = vim.replaced[:len(vim.replaced)-1]
+	if original == "\n" {
+		if cursor, err = Backspace(buffer, cursor); err != nil {
+			return
+		}
+		return buffer.SetCursor(cursor)
+	}
+
+	previous, _ := prevPoint(buffer, cursor)
+	line := buffer.Lines()[cursor.y]
+	if err = SetLine(buffer, cursor.y, line[:previous.x]+original+line[cursor.x:]); err != nil {
+		return
+	}
+	return buffer.SetCursor(previous)
+}
+
+// type keys recorded during an insert again, '\n' is enter and '\b' backspace
+func (vim *Vim) replayInsert(buffer Buffer, keys []rune) (err error) {
+	for _, key := range keys {
+		switch key {
+		case '\n':
+			err = vim.InsertNewline(buffer)
+		case '\b':
+			err = vim.InsertBackspace(buffer)
+		default:
+			err = vim.InsertText(buffer, string(key))
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// leave insert mode, finishing the change and stepping the cursor back onto
+// the last character inserted like vim does. with a count, what was typed is
+// typed again until it has been inserted count times, unless the count was
+// for what a change deleted. an insert on a block is typed again on the rest
+// of its lines, unless it broke the line
+func (vim *Vim) StopInsert(buffer Buffer) (err error) {
+	keys := vim.inserted
+	opens_line := isVerb(&vim.insert_action, verbOpenLineBelow) || isVerb(&vim.insert_action, verbOpenLineAbove)
+	times := vim.insert_action.Count()
+	if isVerb(&vim.insert_action, verbChange) {
+		times = 1
+	}
+	for i := 1; i < times && err == nil; i++ {
+		if opens_line {
+			err = vim.InsertNewline(buffer)
+		}
+		if err == nil {
+			err = vim.replayInsert(buffer, keys)
+		}
+	}
+	block := vim.block_insert
+	vim.block_insert = nil
+	if block != nil && err == nil && !strings.ContainsRune(string(keys), '\n') {
+		err = vim.insertOnBlock(buffer, block, keys)
+	}
+	if !vim.repeating {
+		vim.last_inserted = keys
+	}
+
+	vim.mode = MODE_NORMAL
+	if vim.insert_change != nil {
+		if commit_err := vim.insert_change.Commit(); err == nil {
+			err = commit_err
+		}
+		vim.insert_change = nil
+	}
+
+	cursor := buffer.Cursor()
+	if cursor.x > 0 {
+		cursor, _ = prevPoint(buffer, cursor)
+	}
+	if block != nil {
+		cursor = columnPoint(buffer, block.column, block.top)
+	}
+	buffer.SetCursor(ClampIn(buffer, cursor))
+	return
+}
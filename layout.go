@@ -31,6 +31,33 @@ type TabListLayout struct {
 	selection int
 }
 
+// create a tab showing the root layout with its first view selected
+func NewTabLayout(root Layout) TabLayout {
+	return TabLayout{root: root, selection: findViewLayout(root)}
+}
+
+// create a layout with a view showing buffer
+func NewViewLayout(buffer Buffer) *ViewLayout {
+	layout := &ViewLayout{}
+	layout.view.SetBuffer(buffer)
+	return layout
+}
+
+// create a layout with a view for each buffer. a single buffer gets a plain
+// view, otherwise the views are split horizontally (stacked on top of each
+// other) or vertically (side by side)
+func NewBuffersLayout(buffers []Buffer, horizontal bool) Layout {
+	if len(buffers) == 1 {
+		return NewViewLayout(buffers[0])
+	}
+
+	list_layout := &ListLayout{horizontal: horizontal}
+	for _, buffer := range buffers {
+		list_layout.layouts = append(list_layout.layouts, NewViewLayout(buffer))
+	}
+	return list_layout
+}
+
 func (layout *ListLayout) Rect() Rect {
 	return layout.rect
 }
@@ -120,10 +147,19 @@ func (layout *ViewLayout) Rect() Rect {
 
 func (layout *ViewLayout) Draw(terminal_dimensions Point, settings *DrawSettings) {
 	if layout.view.buffer != nil {
-		DrawBuffer(layout.view.buffer, layout.view.rect, layout.view.scroll, terminal_dimensions, settings)
+		DrawBuffer(layout.view.buffer, layout.view.rect, layout.view.scroll, terminal_dimensions, settings, &layout.view.selection, layout.view.highlight)
 	}
 }
 
+// create a new layout looking at the same place in the same buffer, with a
+// cursor of its own
+func (layout *ViewLayout) Copy() *ViewLayout {
+	new_layout := NewViewLayout(layout.view.buffer)
+	new_layout.view.cursor = layout.view.cursor
+	new_layout.view.scroll = layout.view.scroll
+	return new_layout
+}
+
 func (layout *ViewLayout) CalculateRect(rect Rect) {
 	layout.view.rect = rect
 }
@@ -282,15 +318,15 @@ func (layout *TabLayout) Split() {
 			panic("unxpected type")
 		case *ViewLayout:
 			new_layout := ListLayout{}
-			new_layout.layouts = append(new_layout.layouts, &ViewLayout{current_node.view})
-			new_layout.layouts = append(new_layout.layouts, &ViewLayout{current_node.view})
+			new_layout.layouts = append(new_layout.layouts, current_node)
+			new_layout.layouts = append(new_layout.layouts, current_node.Copy())
 			layout.root = &new_layout
 		case *ListLayout:
 			existing_view_layout := findViewLayout(current_node)
 			if existing_view_layout == nil {
 				panic("no existing view")
 			}
-			current_node.layouts = append(current_node.layouts, &ViewLayout{existing_view_layout.view})
+			current_node.layouts = append(current_node.layouts, existing_view_layout.Copy())
 		}
 	} else {
 		splitLayout(layout.root, layout.selection)
@@ -303,6 +339,8 @@ func (layout *TabLayout) Split() {
 func (layout *TabLayout) Remove() {
 	if layout.selection != layout.root && viewLayoutCount(layout.root) > 1 {
 		loc := Point{layout.selection.Rect().left, layout.selection.Rect().top}
+		// stop the buffers adjusting the cursors of the views we remove
+		forEachView(layout.selection, func(view *View) { view.SetBuffer(nil) })
 		removeLayoutNode(layout.root, layout.root, layout.selection)
 		layout.CalculateRect(layout.rect)
 		layout.selection = layout.FindView(loc)
@@ -344,7 +382,7 @@ func (layout *TabLayout) Select(direction Direction) {
 		default:
 			panic("unexpected type")
 		case *ViewLayout:
-			cursor := calc_cursor_on_terminal(current_layout.view.buffer.Cursor(), current_layout.view.scroll,
+			cursor := calc_cursor_on_terminal(current_layout.view.Cursor(), current_layout.view.scroll,
 				Point{current_layout.view.rect.left, current_layout.view.rect.top})
 			layout.selection = layout.FindView(Point{new_x, cursor.y})
 		case *ListLayout:
@@ -360,7 +398,7 @@ func (layout *TabLayout) Select(direction Direction) {
 		default:
 			panic("unexpected type")
 		case *ViewLayout:
-			cursor := calc_cursor_on_terminal(current_layout.view.buffer.Cursor(), current_layout.view.scroll,
+			cursor := calc_cursor_on_terminal(current_layout.view.Cursor(), current_layout.view.scroll,
 				Point{current_layout.view.rect.left, current_layout.view.rect.top})
 			layout.selection = layout.FindView(Point{cursor.x, new_y})
 		case *ListLayout:
@@ -376,7 +414,7 @@ func (layout *TabLayout) Select(direction Direction) {
 		default:
 			panic("unexpected type")
 		case *ViewLayout:
-			cursor := calc_cursor_on_terminal(current_layout.view.buffer.Cursor(), current_layout.view.scroll,
+			cursor := calc_cursor_on_terminal(current_layout.view.Cursor(), current_layout.view.scroll,
 				Point{current_layout.view.rect.left, current_layout.view.rect.top})
 			layout.selection = layout.FindView(Point{new_x, cursor.y})
 		case *ListLayout:
@@ -392,7 +430,7 @@ func (layout *TabLayout) Select(direction Direction) {
 		default:
 			panic("unexpected type")
 		case *ViewLayout:
-			cursor := calc_cursor_on_terminal(current_layout.view.buffer.Cursor(), current_layout.view.scroll,
+			cursor := calc_cursor_on_terminal(current_layout.view.Cursor(), current_layout.view.scroll,
 				Point{current_layout.view.rect.left, current_layout.view.rect.top})
 			layout.selection = layout.FindView(Point{cursor.x, new_y})
 		case *ListLayout:
@@ -521,13 +559,13 @@ func splitLayout(itr Layout, match Layout) {
 				default:
 					panic("unexpected type")
 				case *ViewLayout:
-					current_node.layouts = append(current_node.layouts, &ViewLayout{current_child.view})
+					current_node.layouts = append(current_node.layouts, current_child.Copy())
 				case *ListLayout:
 					existing_view_layout := findViewLayout(current_child)
 					if existing_view_layout == nil {
 						panic("no existing view")
 					}
-					current_child.layouts = append(current_child.layouts, &ViewLayout{existing_view_layout.view})
+					current_child.layouts = append(current_child.layouts, existing_view_layout.Copy())
 				}
 			} else {
 				splitLayout(child, match)
@@ -596,3 +634,16 @@ func viewLayoutCount(itr Layout) int {
 
 	return 0
 }
+
+func forEachView(itr Layout, f func(view *View)) {
+	switch current_node := itr.(type) {
+	default:
+		panic("unexpected type")
+	case *ViewLayout:
+		f(&current_node.view)
+	case *ListLayout:
+		for _, child := range current_node.layouts {
+			forEachView(child, f)
+		}
+	}
+}
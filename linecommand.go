@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ex commands which work on whole lines: :d deletes them, :m moves them below
+// another line and :t (or :copy) copies them there, and :normal types keys on
+// each of them as if in normal mode
+
+// :[range]d [x] [count] deletes the lines into register x, or the unnamed
+// register. a count deletes that many lines from the last line of the range
+func deleteCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) error {
+	register, count, err := registerAndCount(arg)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		lines.start = lines.end
+		lines.end = Clamp(lines.end+count-1, lines.start, len(view.buffer.Lines())-1)
+	}
+
+	action := Action{register: register}
+	r := Range{start: Point{0, lines.start}, end: Point{0, lines.end}, linewise: true}
+	return verbDelete(&editor.vim, &action, view.buffer, r)
+}
+
+// the optional register and count given to :d
+func registerAndCount(arg string) (register rune, count int, err error) {
+	fields := strings.Fields(arg)
+	if len(fields) > 0 && (fields[0][0] < '0' || fields[0][0] > '9') {
+		if len(fields[0]) != 1 || !validRegister(rune(fields[0][0])) {
+			return 0, 0, errors.New("invalid register: " + fields[0])
+		}
+		register, fields = rune(fields[0][0]), fields[1:]
+	}
+	if len(fields) > 0 {
+		if count, err = strconv.Atoi(fields[0]); err != nil || count <= 0 {
+			return 0, 0, errors.New("invalid count: " + fields[0])
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		return 0, 0, errors.New("trailing characters: " + strings.Join(fields, " "))
+	}
+	return register, count, nil
+}
+
+// the line given to :m and :t, below which the lines go. 0 puts them above the
+// first line, and is returned as -1
+func destinationLine(editor *Editor, view *View, arg string) (int, error) {
+	last := len(view.buffer.Lines()) - 1
+	current := ClampOn(view.buffer, view.buffer.Cursor()).y
+	line, rest, found, err := parseAddress(editor, arg, current, last)
+	if err != nil {
+		return 0, err
+	}
+	if !found || strings.TrimSpace(rest) != "" {
+		return 0, errors.New("invalid address: " + strings.TrimSpace(arg))
+	}
+	if line < -1 || line > last {
+		return 0, errors.New("invalid range")
+	}
+	return line, nil
+}
+
+// :[range]m {address} moves the lines below the address, leaving the cursor
+// on the last of them
+func moveCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) (err error) {
+	destination, err := destinationLine(editor, view, arg)
+	if err != nil {
+		return err
+	}
+	if destination >= lines.start && destination < lines.end {
+		return errors.New("cannot move a range of lines into itself")
+	}
+
+	buffer := view.buffer
+	if undoer, ok := buffer.(Undoer); ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+
+	moved := append([]string{}, buffer.Lines()[lines.start:lines.end+1]...)
+	for range moved {
+		if err = buffer.DeleteLine(lines.start); err != nil {
+			return
+		}
+	}
+	// lines below the moved lines have moved up
+	if destination > lines.end {
+		destination -= len(moved)
+	}
+	return putLines(buffer, destination+1, moved)
+}
+
+// :[range]t {address} copies the lines below the address, leaving the cursor
+// on the last copy
+func copyCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) (err error) {
+	destination, err := destinationLine(editor, view, arg)
+	if err != nil {
+		return err
+	}
+
+	buffer := view.buffer
+	if undoer, ok := buffer.(Undoer); ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+
+	copied := append([]string{}, buffer.Lines()[lines.start:lines.end+1]...)
+	return putLines(buffer, destination+1, copied)
+}
+
+// insert lines from y and move the cursor to the last of them
+func putLines(buffer Buffer, y int, lines []string) (err error) {
+	for i, line := range lines {
+		if err = buffer.InsertLine(y+i, line); err != nil {
+			return
+		}
+	}
+	last := y + len(lines) - 1
+	return buffer.SetCursor(Point{firstNonBlank(lines[len(lines)-1]), last})
+}
+
+// :[range]normal {keys} types keys in normal mode, at the start of each line
+// of the range or at the cursor without one. anything the keys leave
+// unfinished, like an insert, is ended as if escape was typed
+func normalCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) error {
+	keys := strings.TrimLeft(arg, " \t")
+	if keys == "" {
+		return errors.New("argument required")
+	}
+
+	vim := &editor.vim
+	typeKeys := func() error {
+		for _, key := range keys {
+			if err := vim.HandleKey(key, view.buffer); err != nil {
+				vim.Abandon(view.buffer)
+				return err
+			}
+		}
+		return vim.Abandon(view.buffer)
+	}
+
+	if !lines.given {
+		return typeKeys()
+	}
+	var marks []int
+	for y := lines.start; y <= lines.end; y++ {
+		marks = append(marks, y)
+	}
+	return forEachMarkedLine(view, marks, typeKeys)
+}
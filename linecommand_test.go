@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLineCommands(t *testing.T) {
+	tests := []struct {
+		contents string
+		line     int
+		command  string
+		expected string
+		cursor   Point
+	}{
+		{"1\n2\n3\n4", 1, "d", "1\n3\n4", Point{0, 1}},
+		{"1\n2\n3\n4", 0, "2,3d", "1\n4", Point{0, 1}},
+		{"1\n2\n3\n4", 0, "d 2", "3\n4", Point{0, 0}},
+		{"1\n2\n3\n4", 0, "%d", "", Point{0, 0}},
+		{"1\n2\n3\n4", 0, "m$", "2\n3\n4\n1", Point{0, 3}},
+		{"1\n2\n3\n4", 3, "m0", "4\n1\n2\n3", Point{0, 0}},
+		{"1\n2\n3\n4", 0, "1,2m3", "3\n1\n2\n4", Point{0, 2}},
+		{"1\n2\n3\n4", 0, "3,4m0", "3\n4\n1\n2", Point{0, 1}},
+		{"1\n2\n3\n4", 0, "t.", "1\n1\n2\n3\n4", Point{0, 1}},
+		{"1\n2\n3\n4", 0, "1,2t$", "1\n2\n3\n4\n1\n2", Point{0, 5}},
+		{"1\n2\n3\n4", 0, "4co0", "4\n1\n2\n3\n4", Point{0, 0}},
+		{"a\nb\nc", 0, "normal Ax", "ax\nb\nc", Point{1, 0}},
+		{"a\nb\nc", 0, "%norm Ax", "ax\nbx\ncx", Point{1, 2}},
+		{"a\nb\nc", 0, "%normal dd", "", Point{0, 0}},
+		{"a\nb\nc", 0, "1,2normal yyp", "a\na\nb\nb\nc", Point{0, 3}},
+		{"a b\nc d", 0, "%normal wd$", "a \nc ", Point{1, 1}},
+	}
+	for _, test := range tests {
+		editor, view := newTestEditor(test.contents, test.line)
+		if err := runTestCommand(editor, view, test.command); err != nil {
+			t.Errorf("%q on %q: %v", test.command, test.contents, err)
+			continue
+		}
+		if StringifyBuffer(view.buffer) != test.expected+"\n" || view.Cursor() != test.cursor {
+			t.Errorf("%q cursor %v after %q on %q, expected %q cursor %v",
+				StringifyBuffer(view.buffer), view.Cursor(), test.command, test.contents, test.expected, test.cursor)
+		}
+		if editor.vim.mode != MODE_NORMAL {
+			t.Errorf("left in mode %v after %q", editor.vim.mode, test.command)
+		}
+	}
+
+	for _, invalid := range []string{"2,3m2", "m9", "m", "d q w", "normal"} {
+		editor, view := newTestEditor("1\n2\n3\n4", 0)
+		if err := runTestCommand(editor, view, invalid); err == nil {
+			t.Errorf("%q should fail", invalid)
+		}
+	}
+}
+
+func TestDeleteCommandRegister(t *testing.T) {
+	editor, view := newTestEditor("1\n2\n3", 0)
+	if err := runTestCommand(editor, view, "2,3d a"); err != nil {
+		t.Fatal(err)
+	}
+	register, err := editor.vim.registers.Get('a')
+	if err != nil || !register.linewise || register.String() != "2\n3\n" {
+		t.Fatalf("unexpected register %q, err %v", register.String(), err)
+	}
+}
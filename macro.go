@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// macros record the keys typed into a register with q{register} and type them
+// again with @{register}. recorded keys are plain text in the register, so a
+// macro can be put into a buffer, edited and yanked back
+
+// how deeply macros may play other macros, which stops one playing itself forever
+const maxMacroDepth = 100
+
+// start recording keys into the register named by the key after q. q on its
+// own stops recording, which HandleKey looks after
+func parseRecord(action *Action) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if action.key == 0 {
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+	if !validMacroRegister(action.key) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verbRecord
+	action.verb.param = string(action.key)
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// play the macro in the register named by the key after @, @@ plays the last
+// macro played again
+func parsePlay(action *Action) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if action.key == 0 {
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+	if action.key != '@' && !validRegister(action.key) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verbPlay
+	action.verb.param = string(action.key)
+	action.verb.repeat = true
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// registers which macros can be recorded into
+func validMacroRegister(name rune) bool {
+	return validRegister(name) && name != REGISTER_BLACKHOLE && name != REGISTER_CLIPBOARD && name != REGISTER_SELECTION
+}
+
+func verbRecord(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	vim.recording = []rune(action.verb.param)[0]
+	vim.macro = nil
+	return
+}
+
+// finish recording and store the keys typed in the register
+func (vim *Vim) stopRecording() {
+	vim.registers.Record(vim.recording, string(vim.macro))
+	vim.recording = 0
+}
+
+func verbPlay(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	name := []rune(action.verb.param)[0]
+	if name == '@' {
+		if vim.last_macro == 0 {
+			return errors.New("no previously used register")
+		}
+		name = vim.last_macro
+	}
+
+	register, err := vim.registers.Get(name)
+	if err != nil {
+		return
+	}
+	vim.last_macro = name
+
+	if vim.macro_depth >= maxMacroDepth {
+		return errors.New(fmt.Sprintf("macro @%c plays itself too deeply", name))
+	}
+	vim.macro_depth++
+	defer func() { vim.macro_depth-- }()
+
+	for _, key := range register.String() {
+		if err = vim.HandleKey(key, buffer); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+// feed keys to vim through HandleKey, as typed in any mode
+func handleKeys(t *testing.T, vim *Vim, buffer Buffer, keys string) {
+	for _, key := range keys {
+		if err := vim.HandleKey(key, buffer); err != nil {
+			t.Fatalf("key '%c' in '%s': %v", key, keys, err)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("a\nb\nc\nd\ne\nf")
+
+	handleKeys(t, &vim, buffer, "qaA!\x1bjq")
+	if vim.recording != 0 {
+		t.Fatalf("still recording into %c", vim.recording)
+	}
+	if register, _ := vim.registers.Get('a'); register.String() != "A!\x1bj" {
+		t.Fatalf("recorded %q, expected %q", register.String(), "A!\x1bj")
+	}
+
+	handleKeys(t, &vim, buffer, "@a2@a@@")
+	if expected := "a!\nb!\nc!\nd!\ne!\nf\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after playing, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// upper case appends, and the macro can be put and edited like any text
+	handleKeys(t, &vim, buffer, "qAkq\"ap")
+	if expected := "a!\nb!\nc!\nd!\neA!\x1bjk!\nf\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after putting the macro, expected %q", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestRecordPlayingMacro(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("a\nb\nc\nd")
+
+	// recording b plays a, which only records the @a that played it
+	handleKeys(t, &vim, buffer, "qaA!\x1bjqqb@aq")
+	if register, _ := vim.registers.Get('b'); register.String() != "@a" {
+		t.Fatalf("recorded %q, expected %q", register.String(), "@a")
+	}
+
+	handleKeys(t, &vim, buffer, "@b")
+	if expected := "a!\nb!\nc!\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after playing, expected %q", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestMacroStopsOnError(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("a\nb")
+
+	// putting from an empty register fails, so the j after it never happens
+	vim.registers.Record('q', "A!\x1b\"zpj")
+	if err := vim.HandleKey('@', buffer); err != nil {
+		t.Fatal(err)
+	}
+	if err := vim.HandleKey('q', buffer); err == nil {
+		t.Fatalf("playing the macro succeeded")
+	}
+	if expected := "a!\nb\n"; StringifyBuffer(buffer) != expected || buffer.Cursor() != (Point{1, 0}) {
+		t.Fatalf("buffer '%s' cursor %v, expected '%s' cursor {1 0}", StringifyBuffer(buffer), buffer.Cursor(), expected)
+	}
+
+	// a macro which plays itself stops eventually
+	vim.registers.Record('r', "@r")
+	if err := vim.HandleKey('@', buffer); err != nil {
+		t.Fatal(err)
+	}
+	if err := vim.HandleKey('r', buffer); err == nil {
+		t.Fatalf("playing a macro which plays itself succeeded")
+	}
+}
@@ -1,22 +1,139 @@
 package main
 
 import (
-	"compress/bzip2"
-	"compress/gzip"
 	"flag"
+	"fmt"
 	"github.com/nsf/termbox-go"
 	"io"
 	"log"
 	"os"
-	"strings"
 	"time"
 )
 
 // TODO: greetings 'something about a go pro'
 
+// open a file and load it into a new buffer. compressed files are recognized
+// by their contents and decompressed, and will be compressed again on save.
+// the file "-" is standard input
+func loadFile(file string) (Buffer, error) {
+	if file == "-" {
+		// piped data has nowhere to be saved to until it is given a file name
+		log.Print("Loading standard input")
+		_, b, err := loadCompressed(os.Stdin)
+		return b, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Print("Loading " + file)
+	saver := NewFileSaver(file)
+
+	// directories are listed by Load, which needs the *os.File to do so
+	if info.IsDir() {
+		b := NewUndoer(&BaseBuffer{saver: saver})
+		err = Load(b, f)
+		return b, err
+	}
+
+	var b Buffer
+	saver.compression, b, err = loadCompressed(f)
+	if b != nil {
+		b.SetSaver(saver)
+	}
+	return b, err
+}
+
+// load data which may be compressed into a new buffer
+func loadCompressed(reader io.Reader) (Compression, Buffer, error) {
+	compression, reader, err := DetectCompression(reader)
+	if err != nil {
+		return compression, nil, err
+	}
+
+	decompressor, err := NewDecompressor(reader, compression)
+	if err != nil {
+		return compression, nil, err
+	}
+	defer decompressor.Close()
+
+	b := NewUndoer(&BaseBuffer{})
+	err = Load(b, decompressor)
+	return compression, b, err
+}
+
+// the rune vim handles for a key event. control keys the layout doesn't use,
+// such as ctrl-r, are passed on as their control character. keys vim has no
+// rune for, like the arrow keys, are 0
+func vimKey(ev termbox.Event) rune {
+	switch {
+	case ev.Ch != 0:
+		return ev.Ch
+	case ev.Key == termbox.KeySpace:
+		return ' '
+	case ev.Key == termbox.KeyBackspace, ev.Key == termbox.KeyBackspace2:
+		return KEY_BACKSPACE
+	case ev.Key < termbox.KeySpace:
+		return rune(ev.Key)
+	}
+	return 0
+}
+
+// returns true if a key typed in normal mode goes to vim even when the layout
+// uses it. once vim has started a command it gets every key, so enter, which
+// termbox can't tell apart from ctrl-m, can be the character after r
+func vimWantsKey(vim *Vim, ev termbox.Event) bool {
+	return len(vim.command) != 0 && vimKey(ev) != 0
+}
+
+// returns true when standard input is a pipe or file rather than a terminal
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// load each file into a buffer in the editor's buffer list. files which don't
+// exist yet are created when they're saved, as with :e
+func openFiles(editor *Editor, files []string) ([]Buffer, error) {
+	var buffers []Buffer
+	for _, file := range files {
+		var b Buffer
+		var err error
+		if file == "-" {
+			if b, err = loadFile(file); err == nil {
+				editor.buffers.Add(b, "[stdin]")
+			}
+		} else {
+			b, err = editor.OpenFile(file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loadFile(%s) error: %v", file, err)
+		}
+		buffers = append(buffers, b)
+	}
+	return buffers, nil
+}
+
 func main() {
+	horizontal_splits := flag.Bool("o", false, "open a horizontal split for each file")
+	vertical_splits := flag.Bool("O", false, "open a vertical split for each file")
+	tab_per_file := flag.Bool("p", false, "open a tab for each file")
 	flag.Parse()
 	files := flag.Args()
+	if len(files) == 0 && stdinIsPiped() {
+		files = append(files, "-")
+	}
 	logfile, err := os.OpenFile("ge.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
 	if err != nil {
 		log.Fatalf("Open(ge.log) error: %v", err)
@@ -25,43 +142,19 @@ func main() {
 	defer logfile.Close()
 	log.SetOutput(logfile)
 
-	var buffers []Buffer
-	for _, file := range files {
-		var f io.Reader
-		f, err = os.Open(file)
-		if err != nil {
-			log.Fatalf("Open() error: %v", err)
-		}
-		defer f.(io.ReadCloser).Close()
-
-		// handle reading compressed files
-		switch {
-		case strings.HasSuffix(file, ".gz"):
-			{
-				f, err = gzip.NewReader(f)
-				if err != nil {
-					log.Fatalf("gzip error: %v", err)
-				}
-				defer f.(io.ReadCloser).Close()
-			}
-		case strings.HasSuffix(file, ".bz2"):
-			{
-				f = bzip2.NewReader(f)
-				if err != nil {
-					log.Fatalf("bzip error: %v", err)
-				}
-			}
-		}
-
-		log.Print("Loading " + file)
-		b := NewUndoer(&BaseBuffer{})
-		Load(b, f)
-		buffers = append(buffers, b)
+	var editor Editor
+	buffers, err := openFiles(&editor, files)
+	if err != nil {
+		log.Fatal(err)
 	}
 	if len(buffers) == 0 {
-		panic("Ahhh you didn't load any buffers. We should be able to handle this eventually")
+		// start with an unnamed scratch buffer which asks for a file name when it is first saved
+		b := NewScratchBuffer()
+		editor.buffers.Add(b, "")
+		buffers = append(buffers, b)
 	}
 
+	// termbox reads keys from /dev/tty, so this works even when standard input was piped in
 	err = termbox.Init()
 	if err != nil {
 		return
@@ -71,17 +164,23 @@ func main() {
 	terminal_dimensions := Point{}
 	terminal_dimensions.x, terminal_dimensions.y = termbox.Size()
 
-	tabs := TabListLayout{}
-	tabs.tabs = append(tabs.tabs, TabLayout{})
-	current_tab := &tabs.tabs[tabs.selection]
-	root_layout := ViewLayout{}
-	root_layout.view.buffer = buffers[0]
-	current_tab.root = &root_layout
-	current_tab.selection = current_tab.root
-
-	// TODO: split layout with buffers that we loaded
+	tabs := &editor.tabs
+	switch {
+	case *tab_per_file:
+		for _, b := range buffers {
+			tabs.tabs = append(tabs.tabs, NewTabLayout(NewBuffersLayout([]Buffer{b}, false)))
+		}
+	case *horizontal_splits:
+		tabs.tabs = append(tabs.tabs, NewTabLayout(NewBuffersLayout(buffers, true)))
+	case *vertical_splits:
+		tabs.tabs = append(tabs.tabs, NewTabLayout(NewBuffersLayout(buffers, false)))
+	default:
+		tabs.tabs = append(tabs.tabs, NewTabLayout(NewBuffersLayout(buffers[:1], false)))
+	}
+	current_tab := editor.CurrentTab()
 	cursor_on_terminal := Point{0, 0}
-	settings := Settings{draw: DrawSettings{4}}
+	editor.settings = Settings{draw: DrawSettings{4}, edit: EditSettings{shiftWidth: 4}, statusLine: defaultStatusLine, clipboardProvider: "auto"}
+	settings := &editor.settings
 
 	event_chan := make(chan termbox.Event, 1)
 	go func() {
@@ -90,122 +189,151 @@ func main() {
 		}
 	}()
 
-	var vim Vim
+	vim := &editor.vim
 	vim.init()
+	vim.registers.clipboard = settings.Clipboard
+	vim.settings = &settings.edit
+	vim.search_settings = &settings.search
+
+	command_line := &editor.command_line
 
 loop:
 	for {
+		// commands may have added or switched tabs
+		current_tab = editor.CurrentTab()
 		terminal_dimensions.x, terminal_dimensions.y = termbox.Size()
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 		full_view := Rect{0, 0, terminal_dimensions.x, terminal_dimensions.y}
 		tabs.CalculateRect(full_view)
+		editor.UpdateSelection()
+		editor.UpdateSearchHighlight()
 		tabs.Draw(terminal_dimensions, &settings.draw)
 		selected_view_layout, selected_layout_is_view := current_tab.selection.(*ViewLayout)
 		var b Buffer
 		if selected_layout_is_view {
 			b = selected_view_layout.view.buffer
 			cursor_on_terminal = calc_cursor_on_terminal(
-				PrintableCursor(b, b.Cursor(), &settings.draw),
+				PrintableCursor(b, selected_view_layout.view.Cursor(), &settings.draw),
 				selected_view_layout.view.scroll,
 				Point{selected_view_layout.view.rect.left, selected_view_layout.view.rect.top})
 			termbox.SetCursor(cursor_on_terminal.x, cursor_on_terminal.y)
 		}
 
+		editor.DrawStatusLine(terminal_dimensions.y-1, terminal_dimensions)
+		if command_line.active || command_line.message != "" {
+			command_line.Draw(terminal_dimensions.y-1, terminal_dimensions)
+		}
+
 		termbox.Flush()
 
 		select {
 		case ev := <-event_chan:
 			switch ev.Type {
 			case termbox.EventKey:
-				switch ev.Key {
-				case termbox.KeyEsc:
-					break loop
-				case termbox.KeyCtrlJ:
-					current_tab.Select(DIRECTION_DOWN)
-				case termbox.KeyCtrlK:
-					current_tab.Select(DIRECTION_UP)
-				case termbox.KeyCtrlH:
-					current_tab.Select(DIRECTION_LEFT)
-				case termbox.KeyCtrlL:
-					current_tab.Select(DIRECTION_RIGHT)
-				case termbox.KeyCtrlS:
-					current_tab.Split()
-				case termbox.KeyCtrlQ:
-					current_tab.Remove()
-				case termbox.KeyCtrlC:
-					current_tab.Select(DIRECTION_IN)
-				case termbox.KeyCtrlP:
-					current_tab.Select(DIRECTION_OUT)
-				case termbox.KeyCtrlB:
-					current_tab.PrepareSplit(true)
-				case termbox.KeyCtrlV:
-					current_tab.PrepareSplit(false)
-				case termbox.KeyCtrlN:
-					list_layout, is_list_layout := current_tab.selection.(*ListLayout)
-					if is_list_layout {
-						list_layout.SetHorizontal(true)
-						current_tab.CalculateRect(full_view)
+				command_line.ClearMessage()
+
+				// work on the buffer from the selected view's cursor, and
+				// hand the cursor back to the view once we are done
+				active_view := editor.SelectedView()
+				if active_view != nil {
+					active_view.Activate()
+				}
+
+				if editor.substitution != nil {
+					if err := editor.ConfirmSubstitution(vimKey(ev)); err != nil {
+						command_line.ShowError(err)
+					}
+				} else if command_line.active {
+					if command_line.HandleKey(ev, editor.CompleteCommand) {
+						editor.FinishCommandLine()
+						if editor.quit {
+							break loop
+						}
+					} else if !command_line.active {
+						editor.CancelSearch()
 					}
-				case termbox.KeyCtrlM:
-					list_layout, is_list_layout := current_tab.selection.(*ListLayout)
-					if is_list_layout {
-						list_layout.SetHorizontal(false)
-						current_tab.CalculateRect(full_view)
+				} else if isInserting(vim.mode) && active_view != nil {
+					if err := vim.HandleKey(vimKey(ev), b); err != nil {
+						log.Println(err)
+						command_line.ShowError(err)
 					}
-				case termbox.KeyCtrlT:
-					new_tab := TabLayout{}
-					new_view_layout := ViewLayout{}
-					new_view_layout.view.buffer = buffers[0]
-					new_tab.root = &new_view_layout
-					new_tab.selection = new_tab.root
-					tabs.tabs = append(tabs.tabs, new_tab)
-				case termbox.KeyCtrlY:
-					tabs.selection++
-					tabs.selection %= len(tabs.tabs)
-					current_tab = &tabs.tabs[tabs.selection]
-				default:
-					if selected_layout_is_view && b != nil {
-						switch ev.Ch {
-						default:
-							state, action := vim.ParseAction(ev.Ch)
-							if state == PARSE_ACTION_STATE_COMPLETE {
-								err := vim.Perform(&action, b)
-								if err == nil {
-									//selected_view_layout.view.cursor = b.Cursor()
-								} else {
-									log.Println(err)
-								}
-							}
-						case 'G':
-							new_cursor := Point{0, len(b.Lines()) - 1}
-							b.SetCursor(ClampOn(b, new_cursor))
-						case '$':
-							new_cursor := Point{len(b.Lines()[b.Cursor().y]) - 1, b.Cursor().y}
-							b.SetCursor(ClampOn(b, new_cursor))
-						case '0':
-							new_cursor := Point{0, b.Cursor().y}
-							b.SetCursor(ClampOn(b, new_cursor))
-						case 'J':
-							Join(b, b.Cursor().y)
-						case 'u':
-							undoer, ok := b.(Undoer)
-							if ok {
-								undoer.Undo()
-							}
-						case 'r':
-							undoer, ok := b.(Undoer)
-							if ok {
-								undoer.Redo()
+				} else if vimWantsKey(vim, ev) && b != nil {
+					if err := vim.HandleKey(vimKey(ev), b); err != nil {
+						log.Println(err)
+						command_line.ShowError(err)
+					}
+					editor.StartSearch()
+				} else {
+					switch ev.Key {
+					case termbox.KeyCtrlJ:
+						current_tab.Select(DIRECTION_DOWN)
+					case termbox.KeyCtrlK:
+						current_tab.Select(DIRECTION_UP)
+					case termbox.KeyCtrlH:
+						current_tab.Select(DIRECTION_LEFT)
+					case termbox.KeyCtrlL:
+						current_tab.Select(DIRECTION_RIGHT)
+					case termbox.KeyCtrlS:
+						current_tab.Split()
+					case termbox.KeyCtrlQ:
+						current_tab.Remove()
+					case termbox.KeyCtrlC:
+						current_tab.Select(DIRECTION_IN)
+					case termbox.KeyCtrlP:
+						current_tab.Select(DIRECTION_OUT)
+					case termbox.KeyCtrlB:
+						current_tab.PrepareSplit(true)
+					case termbox.KeyCtrlX:
+						// make the next split vertical. this was ctrl-v until
+						// ctrl-v became visual block mode
+						current_tab.PrepareSplit(false)
+					case termbox.KeyCtrlN:
+						list_layout, is_list_layout := current_tab.selection.(*ListLayout)
+						if is_list_layout {
+							list_layout.SetHorizontal(true)
+							current_tab.CalculateRect(full_view)
+						}
+					case termbox.KeyCtrlM:
+						list_layout, is_list_layout := current_tab.selection.(*ListLayout)
+						if is_list_layout {
+							list_layout.SetHorizontal(false)
+							current_tab.CalculateRect(full_view)
+						}
+					case termbox.KeyCtrlT:
+						// open the buffer we are looking at in the new tab
+						new_buffer := editor.buffers.entries[0].buffer
+						if selected_layout_is_view {
+							new_buffer = selected_view_layout.view.buffer
+						}
+						tabs.tabs = append(tabs.tabs, NewTabLayout(NewBuffersLayout([]Buffer{new_buffer}, false)))
+						// appending may have moved the tabs
+						current_tab = editor.CurrentTab()
+					case termbox.KeyCtrlY:
+						tabs.selection++
+						tabs.selection %= len(tabs.tabs)
+						current_tab = editor.CurrentTab()
+					default:
+						key := vimKey(ev)
+						if key == ':' && len(vim.command) == 0 {
+							editor.StartCommandLine()
+						} else if selected_layout_is_view && b != nil {
+							if err := vim.HandleKey(key, b); err != nil {
+								log.Println(err)
+								command_line.ShowError(err)
 							}
+							editor.StartSearch()
 						}
-						selected_view_layout.view.cursor = b.Cursor()
 					}
 				}
 
+				if active_view != nil {
+					active_view.Deactivate()
+				}
+
 				selected_view_layout, selected_layout_is_view = current_tab.selection.(*ViewLayout)
 				if selected_layout_is_view {
 					selected_view_layout.view.ScrollTo(
-						PrintableCursor(selected_view_layout.view.buffer, selected_view_layout.view.buffer.Cursor(), &settings.draw))
+						PrintableCursor(selected_view_layout.view.buffer, selected_view_layout.view.Cursor(), &settings.draw))
 				}
 
 			}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ex commands can be given the lines they work on before their name, like
+// :1,5d or :%s. a range is one or two addresses separated by ',' or ';'. an
+// address is a line number, '.' for the cursor's line, '$' for the last line
+// or '< and '> for the first and last lines of the last selection, followed
+// by any number of +N and -N offsets. % is every line
+
+// the lines an ex command works on, from start to end inclusive. numbered
+// from 0, unlike the addresses typed
+type LineRange struct {
+	start int
+	end   int
+	// false when no range was typed, so the command chooses its own default
+	given bool
+}
+
+// parse the range at the start of an ex command, returning it along with the
+// rest of the command. without a range the cursor's line is returned
+func parseRange(editor *Editor, view *View, command string) (LineRange, string, error) {
+	last := len(view.buffer.Lines()) - 1
+	current := ClampOn(view.buffer, view.buffer.Cursor()).y
+
+	command = strings.TrimLeft(command, " \t")
+	if strings.HasPrefix(command, "%") {
+		return LineRange{0, last, true}, command[1:], nil
+	}
+
+	start, command, found, err := parseAddress(editor, command, current, last)
+	if err != nil || !found {
+		return LineRange{current, current, false}, command, err
+	}
+
+	end := start
+	command = strings.TrimLeft(command, " \t")
+	if strings.HasPrefix(command, ",") || strings.HasPrefix(command, ";") {
+		// with ; the second address is relative to the first
+		if command[0] == ';' {
+			current = start
+		}
+		if end, command, found, err = parseAddress(editor, command[1:], current, last); err != nil {
+			return LineRange{current, current, false}, command, err
+		} else if !found {
+			end = current
+		}
+	}
+
+	if start > end {
+		start, end = end, start
+	}
+	if start < 0 || end > last {
+		return LineRange{current, current, false}, command, errors.New("invalid range")
+	}
+	return LineRange{start, end, true}, command, nil
+}
+
+// parse one address at the start of text, returning the line it refers to
+// and the rest of text. found is false when text doesn't start with one
+func parseAddress(editor *Editor, text string, current int, last int) (line int, rest string, found bool, err error) {
+	text = strings.TrimLeft(text, " \t")
+	line = current
+
+	switch {
+	case text == "":
+	case unicode.IsDigit(rune(text[0])):
+		digits := numberPrefix(text)
+		number, _ := strconv.Atoi(text[:digits])
+		line, text, found = number-1, text[digits:], true
+	case text[0] == '.':
+		text, found = text[1:], true
+	case text[0] == '$':
+		line, text, found = last, text[1:], true
+	case text[0] == '\'':
+		if len(text) < 2 || (text[1] != '<' && text[1] != '>') {
+			return current, text, false, errors.New("unknown mark")
+		}
+		top, bottom, ok := editor.vim.SelectionMarks()
+		if !ok {
+			return current, text, false, errors.New("mark not set")
+		}
+		line = top
+		if text[1] == '>' {
+			line = bottom
+		}
+		text, found = text[2:], true
+	}
+
+	// offsets, where a + or - on its own is one line
+	for len(text) > 0 && (text[0] == '+' || text[0] == '-') {
+		sign := 1
+		if text[0] == '-' {
+			sign = -1
+		}
+		text = text[1:]
+		offset := 1
+		if digits := numberPrefix(text); digits > 0 {
+			offset, _ = strconv.Atoi(text[:digits])
+			text = text[digits:]
+		}
+		line += sign * offset
+		found = true
+	}
+	return line, text, found, nil
+}
+
+// the number of digits at the start of text
+func numberPrefix(text string) int {
+	digits := 0
+	for digits < len(text) && text[digits] >= '0' && text[digits] <= '9' {
+		digits++
+	}
+	return digits
+}
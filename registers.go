@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// text held in a register. characterwise text is spliced into a line when put,
+// with a line break between each of its lines, while linewise text is put as
+// whole lines and blockwise text as a column on each line
+type Register struct {
+	lines     []string
+	linewise  bool
+	blockwise bool
+}
+
+// the registers text is yanked into and put from, keyed by name. '"' is the
+// unnamed register, which holds whatever was last yanked or deleted, '0' holds
+// the last yank and '1' to '9' the last deletes of whole lines. '+' and '*'
+// are the system clipboard and primary selection
+type Registers struct {
+	registers map[rune]Register
+	// returns the clipboard to use for '+' and '*'
+	clipboard func() (Clipboard, error)
+}
+
+const (
+	REGISTER_UNNAMED   rune = '"'
+	REGISTER_YANK      rune = '0'
+	REGISTER_BLACKHOLE rune = '_'
+	REGISTER_CLIPBOARD rune = '+'
+	REGISTER_SELECTION rune = '*'
+)
+
+// returns true if name can be given to a command with "
+func validRegister(name rune) bool {
+	switch {
+	case name == REGISTER_UNNAMED, name == REGISTER_BLACKHOLE:
+		return true
+	case name == REGISTER_CLIPBOARD, name == REGISTER_SELECTION:
+		return true
+	case name >= '0' && name <= '9':
+		return true
+	case name >= 'a' && name <= 'z', name >= 'A' && name <= 'Z':
+		return true
+	}
+	return false
+}
+
+func (register Register) String() string {
+	text := strings.Join(register.lines, "\n")
+	if register.linewise {
+		text += "\n"
+	}
+	return text
+}
+
+// the text in a register, split into its lines. text ending in a line break is
+// made of whole lines
+func NewRegister(text string) Register {
+	linewise := strings.HasSuffix(text, "\n")
+	if linewise {
+		text = text[:len(text)-1]
+	}
+	return Register{lines: strings.Split(text, "\n"), linewise: linewise}
+}
+
+// returns the register with the given name, 0 for the unnamed register
+func (registers *Registers) Get(name rune) (Register, error) {
+	switch name {
+	case 0:
+		name = REGISTER_UNNAMED
+	case REGISTER_CLIPBOARD, REGISTER_SELECTION:
+		clipboard, err := registers.getClipboard()
+		if err != nil {
+			return Register{}, err
+		}
+		text, err := clipboard.Get(name == REGISTER_SELECTION)
+		if err != nil {
+			return Register{}, err
+		}
+		return NewRegister(text), nil
+	}
+
+	register, ok := registers.registers[unicode.ToLower(name)]
+	if !ok {
+		return register, errors.New(fmt.Sprintf("nothing in register %c", name))
+	}
+	return register, nil
+}
+
+// store yanked text in the register named, or in the yank register if no
+// register was given
+func (registers *Registers) Yank(name rune, register Register) error {
+	if name == 0 {
+		name = REGISTER_YANK
+	}
+	return registers.store(name, register)
+}
+
+// store deleted text in the register named. without a name, deletes of whole
+// lines or text spanning lines shift the numbered registers along and go in '1'
+func (registers *Registers) Delete(name rune, register Register) error {
+	if name != 0 {
+		return registers.store(name, register)
+	}
+
+	if register.linewise || len(register.lines) > 1 {
+		registers.init()
+		for i := '9'; i > '1'; i-- {
+			if previous, ok := registers.registers[i-1]; ok {
+				registers.registers[i] = previous
+			}
+		}
+		return registers.store('1', register)
+	}
+	return registers.store(REGISTER_UNNAMED, register)
+}
+
+// store the keys of a macro in a register, appending for an upper case name
+func (registers *Registers) Record(name rune, keys string) {
+	register := Register{lines: []string{keys}}
+	if unicode.IsUpper(name) {
+		name = unicode.ToLower(name)
+		if previous, ok := registers.registers[name]; ok {
+			register = previous.Append(register)
+		}
+	}
+	registers.init()
+	registers.registers[name] = register
+}
+
+// store text in a register and the unnamed register. an upper case name appends
+// to the lower case register, and the blackhole register throws the text away
+func (registers *Registers) store(name rune, register Register) error {
+	if name == REGISTER_BLACKHOLE {
+		return nil
+	}
+	registers.init()
+
+	if name == REGISTER_CLIPBOARD || name == REGISTER_SELECTION {
+		clipboard, err := registers.getClipboard()
+		if err != nil {
+			return err
+		}
+		if err = clipboard.Set(name == REGISTER_SELECTION, register.String()); err != nil {
+			return err
+		}
+		registers.registers[REGISTER_UNNAMED] = register
+		return nil
+	}
+
+	if unicode.IsUpper(name) {
+		name = unicode.ToLower(name)
+		if previous, ok := registers.registers[name]; ok {
+			register = previous.Append(register)
+		}
+	}
+	registers.registers[name] = register
+	registers.registers[REGISTER_UNNAMED] = register
+	return nil
+}
+
+func (registers *Registers) getClipboard() (Clipboard, error) {
+	if registers.clipboard == nil {
+		return nil, errors.New("no clipboard")
+	}
+	return registers.clipboard()
+}
+
+func (registers *Registers) init() {
+	if registers.registers == nil {
+		registers.registers = make(map[rune]Register)
+	}
+}
+
+// join two registers' text. appending whole lines to anything, or anything
+// to whole lines, gives whole lines
+func (register Register) Append(other Register) Register {
+	if len(register.lines) == 0 {
+		return other
+	}
+
+	lines := append([]string{}, register.lines...)
+	if register.linewise || other.linewise {
+		return Register{lines: append(lines, other.lines...), linewise: true}
+	}
+
+	last := len(lines) - 1
+	lines[last] += other.lines[0]
+	return Register{lines: append(lines, other.lines[1:]...)}
+}
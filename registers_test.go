@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRegisters(t *testing.T) {
+	var registers Registers
+	get := func(name rune) string {
+		register, _ := registers.Get(name)
+		return register.String()
+	}
+
+	registers.Yank(0, Register{lines: []string{"yanked"}})
+	if get(0) != "yanked" || get('0') != "yanked" {
+		t.Fatalf("unnamed '%s' and 0 '%s' after yank", get(0), get('0'))
+	}
+
+	// deletes of whole lines shift along the numbered registers
+	registers.Delete(0, Register{lines: []string{"first"}, linewise: true})
+	registers.Delete(0, Register{lines: []string{"second"}, linewise: true})
+	if get('1') != "second\n" || get('2') != "first\n" || get(0) != "second\n" || get('0') != "yanked" {
+		t.Fatalf("1 '%s' 2 '%s' unnamed '%s' 0 '%s' after deletes", get('1'), get('2'), get(0), get('0'))
+	}
+
+	// small deletes only go in the unnamed register
+	registers.Delete(0, Register{lines: []string{"word"}})
+	if get(0) != "word" || get('1') != "second\n" {
+		t.Fatalf("unnamed '%s' 1 '%s' after small delete", get(0), get('1'))
+	}
+
+	// upper case names append
+	registers.Yank('a', Register{lines: []string{"one"}})
+	registers.Yank('A', Register{lines: []string{"two"}})
+	if get('a') != "onetwo" || get(0) != "onetwo" || get('0') != "yanked" {
+		t.Fatalf("a '%s' unnamed '%s' 0 '%s' after appending", get('a'), get(0), get('0'))
+	}
+	registers.Yank('A', Register{lines: []string{"three"}, linewise: true})
+	if get('a') != "onetwo\nthree\n" {
+		t.Fatalf("a '%s' after appending lines", get('a'))
+	}
+
+	registers.Delete('_', Register{lines: []string{"gone"}})
+	if get(0) != "onetwo\nthree\n" {
+		t.Fatalf("unnamed '%s' after deleting into the blackhole", get(0))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// the saver interface writes the contents of a buffer out to wherever the
+// buffer should be persisted, usually the file it was loaded from
+type Saver interface {
+	// write everything read from reader out to the save location
+	Save(reader io.Reader) (err error)
+	// where the saver writes to
+	Path() string
+}
+
+// returned when saving a buffer that has never been given a place to save to
+var ErrNoFileName = errors.New("no file name")
+
+// mode used when saving a file which does not exist yet
+const defaultFileMode os.FileMode = 0664
+
+// saves a buffer to a file on disk
+type FileSaver struct {
+	path string
+	// files are written back compressed the same way they were loaded
+	compression Compression
+}
+
+func NewFileSaver(path string) *FileSaver {
+	return &FileSaver{path: path}
+}
+
+func (saver *FileSaver) Path() string {
+	return saver.path
+}
+
+// write the contents of reader to the file. the write is atomic: everything is
+// written to a temporary file next to the original which is then renamed over
+// it, so a failed save never leaves a half written file behind. the mode bits
+// of an existing file are kept
+func (saver *FileSaver) Save(reader io.Reader) (err error) {
+	path := saver.path
+	mode := defaultFileMode
+
+	// write through symlinks rather than replacing them with a regular file
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return errors.New(fmt.Sprintf("%s is a directory", saver.path))
+		}
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".ge")
+	if err != nil {
+		return err
+	}
+
+	// clean up the temporary file unless it was renamed into place
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	compressor, err := NewCompressor(tmp, saver.compression)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(compressor, reader); err != nil {
+		compressor.Close()
+		return err
+	}
+	if err = compressor.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// save the buffer to path. a buffer with nowhere to save to takes path as its
+// file name, any other buffer is written to path once and keeps its own name
+func SaveAs(buffer Buffer, path string) error {
+	if buffer.Saver() == nil {
+		buffer.SetSaver(NewFileSaver(path))
+		return buffer.Save()
+	}
+	// always save the whole buffer, even if someone stopped reading part way
+	buffer.Rewind()
+	return NewFileSaver(path).Save(buffer)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.txt")
+	contents := "line0\nline1\n"
+	err = ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := &BaseBuffer{saver: NewFileSaver(path)}
+	Load(buffer, strings.NewReader(contents))
+	err = buffer.SetLine(1, "new1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = buffer.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "line0\nnew1\n" {
+		t.Fatalf("unexpected file contents '%s'", saved)
+	}
+
+	// the original mode bits should be kept
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("file mode changed to %v", info.Mode())
+	}
+
+	// the temporary file should have been renamed into place
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected only the saved file in %s, found %d files", dir, len(names))
+	}
+}
+
+func TestSaveNewFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// files given on the command line which don't exist yet are created on save
+	path := filepath.Join(dir, "new.txt")
+	var editor Editor
+	buffers, err := openFiles(&editor, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if StringifyBuffer(buffers[0]) != "\n" {
+		t.Fatalf("unexpected contents '%s' for a new file", StringifyBuffer(buffers[0]))
+	}
+
+	err = buffers[0].SetLine(0, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buffers[0].Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "new" {
+		t.Fatalf("unexpected file contents '%s'", saved)
+	}
+}
+
+func TestSaveWithoutFileName(t *testing.T) {
+	buffer := &BaseBuffer{}
+	Load(buffer, strings.NewReader("line0"))
+	if err := buffer.Save(); err != ErrNoFileName {
+		t.Fatalf("expected ErrNoFileName, got %v", err)
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected Compression
+	}{
+		{"plain text", COMPRESSION_NONE},
+		{"", COMPRESSION_NONE},
+		{"\x1f\x8b\x08", COMPRESSION_GZIP},
+		{"BZh91AY&SY", COMPRESSION_BZIP2},
+		{"BZh", COMPRESSION_NONE},
+		{"BZhello world", COMPRESSION_NONE},
+		{"BZh0", COMPRESSION_NONE},
+		{"\xfd7zXZ\x00\x00", COMPRESSION_XZ},
+	}
+	for _, test := range tests {
+		compression, reader, err := DetectCompression(strings.NewReader(test.contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compression != test.expected {
+			t.Errorf("detected %v compression in %q, expected %v", compression, test.contents, test.expected)
+		}
+		// the peeked bytes are still there to read
+		if read, _ := ioutil.ReadAll(reader); string(read) != test.contents {
+			t.Errorf("read back %q from %q", read, test.contents)
+		}
+	}
+}
+
+func TestSaveCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// no suffix, the compression should be found by looking at the contents
+	path := filepath.Join(dir, "renamed-log")
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("line0\nline1"))
+	writer.Close()
+
+	compression, reader, err := DetectCompression(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression != COMPRESSION_GZIP {
+		t.Fatalf("detected %v compression, expected gzip", compression)
+	}
+
+	decompressor, err := NewDecompressor(reader, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := &BaseBuffer{saver: &FileSaver{path: path, compression: compression}}
+	Load(buffer, decompressor)
+	decompressor.Close()
+
+	buffer.SetLine(0, "new0")
+	if err = buffer.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("saved file is not gzip compressed: %v", err)
+	}
+	saved, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "new0\nline1" {
+		t.Fatalf("unexpected file contents '%s'", saved)
+	}
+}
+
+func TestSaveAsAfterPartialRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	buffer := &BaseBuffer{saver: NewFileSaver(filepath.Join(dir, "original"))}
+	Load(buffer, strings.NewReader("line0\nline1\nline2"))
+
+	// a read which stopped part way through the buffer
+	if _, err = buffer.Read(make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "copy")
+	if err = SaveAs(buffer, path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "line0\nline1\nline2" {
+		t.Fatalf("unexpected file contents '%s'", saved)
+	}
+}
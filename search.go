@@ -0,0 +1,494 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// / and ? search forward and backward for a pattern typed after them, which
+// is finished with enter. a search is a motion, so d/foo deletes up to the next
+// foo. patterns are written the way vim writes them and translated to go's
+// regexp syntax, see translatePattern
+
+// a search made with /, ?, * or #, which n and N repeat
+type Search struct {
+	pattern string
+	forward bool
+}
+
+// how searches match the case of letters. with smartCase a pattern containing
+// an upper case letter matches case even when ignoreCase is set
+type SearchSettings struct {
+	ignoreCase bool
+	smartCase  bool
+}
+
+// how a pattern asked for case to be matched with \c or \C
+type caseOverride int
+
+const (
+	CASE_DEFAULT caseOverride = iota
+	CASE_IGNORE
+	CASE_MATCH
+)
+
+// how much of a pattern is special without a backslash, set by \v, \m, \M and \V
+type magicLevel int
+
+const (
+	MAGIC_VERY_NO magicLevel = iota
+	MAGIC_NO
+	MAGIC
+	MAGIC_VERY
+)
+
+// the character classes vim has escapes for which go doesn't
+var searchClasses = map[rune]string{
+	'a': "[a-zA-Z]",
+	'A': "[^a-zA-Z]",
+	'l': "[a-z]",
+	'L': "[^a-z]",
+	'u': "[A-Z]",
+	'U': "[^A-Z]",
+	'x': "[0-9a-fA-F]",
+	'X': "[^0-9a-fA-F]",
+	'h': "[a-zA-Z_]",
+	'H': "[^a-zA-Z_]",
+	'o': "[0-7]",
+	'O': "[^0-7]",
+}
+
+func parseSearchForward(action *Action) ParseActionState {
+	return parseSearch(action, motionSearchForward)
+}
+
+func parseSearchBackward(action *Action) ParseActionState {
+	return parseSearch(action, motionSearchBackward)
+}
+
+// the keys typed after / or ? are the pattern, until enter completes the
+// search. backspacing over an empty pattern abandons it
+func parseSearch(action *Action, motion MotionFunc) ParseActionState {
+	if action.key == 0 {
+		action.motion.function = motion
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+
+	switch action.key {
+	case KEY_ENTER, '\n':
+		return parseMotion(action, motion)
+	case KEY_BACKSPACE, '\b':
+		if action.motion.param == "" {
+			return PARSE_ACTION_STATE_INVALID
+		}
+		_, size := utf8.DecodeLastRuneInString(action.motion.param)
+		action.motion.param = action.motion.param[:len(action.motion.param)-size]
+	default:
+		action.motion.param += string(action.key)
+	}
+	return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+}
+
+// n repeats the last search
+func parseSearchNext(action *Action) ParseActionState {
+	return parseMotion(action, motionSearchNext)
+}
+
+// N repeats the last search in the other direction
+func parseSearchPrevious(action *Action) ParseActionState {
+	return parseMotion(action, motionSearchPrevious)
+}
+
+// * searches forward for the word under the cursor
+func parseSearchWordForward(action *Action) ParseActionState {
+	return parseMotion(action, motionSearchWordForward)
+}
+
+// # searches backward for the word under the cursor
+func parseSearchWordBackward(action *Action) ParseActionState {
+	return parseMotion(action, motionSearchWordBackward)
+}
+
+// the prompt of the search an action is waiting for the pattern of, 0 if it
+// isn't a search
+func searchPrompt(action *Action) rune {
+	switch {
+	case isMotion(action, motionSearchForward):
+		return '/'
+	case isMotion(action, motionSearchBackward):
+		return '?'
+	}
+	return 0
+}
+
+// the prompt of the search being typed, "" when there isn't one
+func (vim *Vim) SearchPrompt() string {
+	if vim.searching == 0 {
+		return ""
+	}
+	return string(vim.searching)
+}
+
+func motionSearchForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return vim.motionNewSearch(action, buffer, Search{searchPattern(action.motion.param, '/'), true})
+}
+
+func motionSearchBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return vim.motionNewSearch(action, buffer, Search{searchPattern(action.motion.param, '?'), false})
+}
+
+// search for a typed pattern, which is remembered for n and N. an empty
+// pattern searches for the last one again
+func (vim *Vim) motionNewSearch(action *Action, buffer Buffer, search Search) (r Range) {
+	if search.pattern == "" {
+		search.pattern = vim.last_search.pattern
+	}
+	vim.last_search = search
+	return vim.motionSearch(action, buffer, search, buffer.Cursor())
+}
+
+func motionSearchNext(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return vim.motionSearch(action, buffer, vim.last_search, buffer.Cursor())
+}
+
+func motionSearchPrevious(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	search := vim.last_search
+	search.forward = !search.forward
+	return vim.motionSearch(action, buffer, search, buffer.Cursor())
+}
+
+func motionSearchWordForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return vim.motionSearchWord(action, buffer, true)
+}
+
+func motionSearchWordBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return vim.motionSearchWord(action, buffer, false)
+}
+
+// search for the whole word under the cursor, or the next one on the line.
+// the search starts from the start of the word so it isn't found again
+func (vim *Vim) motionSearchWord(action *Action, buffer Buffer, forward bool) (r Range) {
+	cursor := buffer.Cursor()
+	start, end, found := keywordAt(buffer.Lines()[cursor.y], cursor.x)
+	if !found {
+		vim.motion_err = errors.New("no string under cursor")
+		return Range{start: cursor, end: cursor}
+	}
+
+	line := buffer.Lines()[cursor.y]
+	search := Search{`\<` + line[start:end] + `\>`, forward}
+	vim.last_search = search
+	r = vim.motionSearch(action, buffer, search, Point{start, cursor.y})
+	r.start = cursor
+	return r
+}
+
+// the word character run at or after x in line
+func keywordAt(line string, x int) (start int, end int, found bool) {
+	start = x
+	for start < len(line) {
+		ch, size := utf8.DecodeRuneInString(line[start:])
+		if isKeyword(ch) {
+			break
+		}
+		start += size
+	}
+	if start >= len(line) {
+		return 0, 0, false
+	}
+	for start > 0 {
+		ch, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isKeyword(ch) {
+			break
+		}
+		start -= size
+	}
+
+	end = start
+	for end < len(line) {
+		ch, size := utf8.DecodeRuneInString(line[end:])
+		if !isKeyword(ch) {
+			break
+		}
+		end += size
+	}
+	return start, end, true
+}
+
+func isKeyword(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// the range from the cursor to the count'th match of search after (or before)
+// from, wrapping around the buffer. when there is no match the range is empty
+// and the error stops the action
+func (vim *Vim) motionSearch(action *Action, buffer Buffer, search Search, from Point) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = r.start
+	if search.pattern == "" {
+		vim.motion_err = errors.New("no previous search")
+		return r
+	}
+
+	re, err := CompileSearch(search.pattern, vim.search_settings)
+	if err != nil {
+		vim.motion_err = err
+		return r
+	}
+
+	for i := 0; i < action.Count(); i++ {
+		var found bool
+		if from, found = findMatch(buffer, re, from, search.forward); !found {
+			vim.motion_err = errors.New(fmt.Sprintf("pattern not found: %s", search.pattern))
+			return r
+		}
+	}
+	r.end = from
+	return r
+}
+
+// find the start of the next match of re after from, or the last one before
+// it, wrapping around the buffer to from's line again
+func findMatch(buffer Buffer, re *regexp.Regexp, from Point, forward bool) (Point, bool) {
+	lines := buffer.Lines()
+	for i := 0; i <= len(lines); i++ {
+		y := from.y + i
+		if !forward {
+			y = from.y - i
+		}
+		y = (y%len(lines) + len(lines)) % len(lines)
+
+		// on from's line, only matches on the right side of from the first
+		// time round and only those on the other side after wrapping
+		matches := re.FindAllStringIndex(lines[y], -1)
+		if !forward {
+			for j := len(matches) - 1; j >= 0; j-- {
+				x := matches[j][0]
+				if i == 0 && x >= from.x || i == len(lines) && x < from.x {
+					continue
+				}
+				return Point{x, y}, true
+			}
+			continue
+		}
+		for _, match := range matches {
+			x := match[0]
+			if i == 0 && x <= from.x || i == len(lines) && x > from.x {
+				continue
+			}
+			return Point{x, y}, true
+		}
+	}
+	return from, false
+}
+
+// the pattern of a search typed after prompt, which ends at an unescaped
+// prompt character like it does in vim
+func searchPattern(typed string, prompt rune) string {
+	escaped := false
+	for i, ch := range typed {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == prompt:
+			return typed[:i]
+		}
+	}
+	return typed
+}
+
+// compile a vim pattern, ignoring case as the settings and the pattern ask
+func CompileSearch(pattern string, settings *SearchSettings) (*regexp.Regexp, error) {
+	translated, override := translatePattern(pattern)
+
+	ignore_case := settings != nil && settings.ignoreCase && !(settings.smartCase && hasUpper(pattern))
+	switch override {
+	case CASE_IGNORE:
+		ignore_case = true
+	case CASE_MATCH:
+		ignore_case = false
+	}
+	if ignore_case {
+		translated = "(?i)" + translated
+	}
+
+	re, err := regexp.Compile(translated)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid pattern: %s", pattern))
+	}
+	return re, nil
+}
+
+// returns true if the pattern has an upper case letter which isn't part of an
+// escape like \S
+func hasUpper(pattern string) bool {
+	escaped := false
+	for _, ch := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case unicode.IsUpper(ch):
+			return true
+		}
+	}
+	return false
+}
+
+// translate a vim pattern to go's regexp syntax. the magic characters and
+// escapes vim and go share are kept, vim's escapes for grouping, alternation,
+// repeats, word boundaries and character classes are translated, and anything
+// else is matched literally
+func translatePattern(pattern string) (string, caseOverride) {
+	var out strings.Builder
+	override := CASE_DEFAULT
+	level := MAGIC
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		escaped := false
+		if ch == '\\' && i+1 < len(runes) {
+			i++
+			ch = runes[i]
+			escaped = true
+
+			switch ch {
+			case 'v':
+				level = MAGIC_VERY
+				continue
+			case 'm':
+				level = MAGIC
+				continue
+			case 'M':
+				level = MAGIC_NO
+				continue
+			case 'V':
+				level = MAGIC_VERY_NO
+				continue
+			case 'c':
+				override = CASE_IGNORE
+				continue
+			case 'C':
+				override = CASE_MATCH
+				continue
+			case 's', 'S', 'd', 'D', 'w', 'W', 'n', 't':
+				out.WriteRune('\\')
+				out.WriteRune(ch)
+				continue
+			}
+			if class, ok := searchClasses[ch]; ok {
+				out.WriteString(class)
+				continue
+			}
+		}
+
+		special := false
+		switch {
+		case ch == '^' || ch == '$':
+			special = !escaped
+		case strings.ContainsRune(".*[", ch):
+			special = escaped != (level >= MAGIC)
+		case strings.ContainsRune("()|+?={<>", ch):
+			special = escaped != (level == MAGIC_VERY)
+		}
+		if !special {
+			out.WriteString(regexp.QuoteMeta(string(ch)))
+			continue
+		}
+
+		switch ch {
+		case '?', '=':
+			out.WriteRune('?')
+		case '<', '>':
+			out.WriteString(`\b`)
+		case '[':
+			class, end := bracketExpression(runes, i)
+			if end < 0 {
+				out.WriteString(`\[`)
+				continue
+			}
+			out.WriteString(class)
+			i = end
+		case '{':
+			repeat, end := braceRepeat(runes, i)
+			if end < 0 {
+				out.WriteString(`\{`)
+				continue
+			}
+			out.WriteString(repeat)
+			i = end
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	return out.String(), override
+}
+
+// the character class starting with the [ at runes[start], and the index of
+// its closing ]. the end is -1 if it isn't closed, when vim matches [
+// literally
+func bracketExpression(runes []rune, start int) (string, int) {
+	i := start + 1
+	if i < len(runes) && runes[i] == '^' {
+		i++
+	}
+	// a ] straight after the [ or [^ is part of the class
+	if i < len(runes) && runes[i] == ']' {
+		i++
+	}
+	for ; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\':
+			i++
+		case runes[i] == '[' && i+1 < len(runes) && runes[i+1] == ':':
+			// a named class like [:alpha:]
+			if end := strings.Index(string(runes[i:]), ":]"); end >= 0 {
+				i += utf8.RuneCountInString(string(runes[i:])[:end]) + 1
+			}
+		case runes[i] == ']':
+			return string(runes[start : i+1]), i
+		}
+	}
+	return "", -1
+}
+
+// the repeat starting with the { at runes[start], and the index of its closing
+// }. vim writes {n,m} as go does, and {-n,m} for as few as possible
+func braceRepeat(runes []rune, start int) (string, int) {
+	end := start + 1
+	for end < len(runes) && runes[end] != '}' {
+		end++
+	}
+	if end >= len(runes) {
+		return "", -1
+	}
+
+	bounds := strings.TrimSuffix(string(runes[start+1:end]), `\`)
+	lazy := strings.HasPrefix(bounds, "-")
+	bounds = strings.TrimPrefix(bounds, "-")
+	if strings.Trim(bounds, "0123456789,") != "" || strings.Count(bounds, ",") > 1 {
+		return "", -1
+	}
+
+	repeat := ""
+	switch {
+	case bounds == "" || bounds == ",":
+		repeat = "*"
+	case strings.HasPrefix(bounds, ","):
+		repeat = "{0" + bounds + "}"
+	default:
+		repeat = "{" + bounds + "}"
+	}
+	if lazy {
+		repeat += "?"
+	}
+	return repeat, end
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTranslatePattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{`foo`, `foo`},
+		{`\<foo\>`, `\bfoo\b`},
+		{`a.*b$`, `a.*b$`},
+		{`\(ab\)\+`, `(ab)+`},
+		{`a\|b`, `a|b`},
+		{`(a|b)+?`, `\(a\|b\)\+\?`},
+		{`colou\=r`, `colou?r`},
+		{`a\{2,3}`, `a{2,3}`},
+		{`a\{-1,}`, `a{1,}?`},
+		{`a\{}`, `a*`},
+		{`\v(a|b){2}<`, `(a|b){2}\b`},
+		{`\v\(a\)`, `\(a\)`},
+		{`\V.*`, `\.\*`},
+		{`[a-z]\+`, `[a-z]+`},
+		{`[]x]`, `[]x]`},
+		{`[[:digit:]]`, `[[:digit:]]`},
+		{`[abc`, `\[abc`},
+		{`\d\s\w`, `\d\s\w`},
+		{`\u\l\x`, `[A-Z][a-z][0-9a-fA-F]`},
+		{`\/`, `/`},
+		{`a\.b`, `a\.b`},
+	}
+	for _, test := range tests {
+		if translated, _ := translatePattern(test.pattern); translated != test.expected {
+			t.Errorf("%q translated to %q, expected %q", test.pattern, translated, test.expected)
+		}
+	}
+}
+
+func TestSearchCase(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		settings SearchSettings
+		text     string
+		matches  bool
+	}{
+		{"foo", SearchSettings{}, "FOO", false},
+		{"foo", SearchSettings{ignoreCase: true}, "FOO", true},
+		{"Foo", SearchSettings{ignoreCase: true}, "FOO", true},
+		{"Foo", SearchSettings{ignoreCase: true, smartCase: true}, "FOO", false},
+		{"foo", SearchSettings{ignoreCase: true, smartCase: true}, "FOO", true},
+		{`\Sfoo`, SearchSettings{ignoreCase: true, smartCase: true}, "XFOO", true},
+		{`foo\c`, SearchSettings{}, "FOO", true},
+		{`foo\C`, SearchSettings{ignoreCase: true}, "FOO", false},
+	}
+	for _, test := range tests {
+		re, err := CompileSearch(test.pattern, &test.settings)
+		if err != nil {
+			t.Fatalf("%q: %v", test.pattern, err)
+		}
+		if re.MatchString(test.text) != test.matches {
+			t.Errorf("%q with %+v matching %q should be %v", test.pattern, test.settings, test.text, test.matches)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []keysTest{
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/foo\r", "foo\nbar foo\nfoo", Point{4, 1}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/foo\rn", "foo\nbar foo\nfoo", Point{0, 2}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/foo\rnn", "foo\nbar foo\nfoo", Point{0, 0}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "2/foo\r", "foo\nbar foo\nfoo", Point{0, 2}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "?foo\r", "foo\nbar foo\nfoo", Point{0, 2}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "?foo\rn", "foo\nbar foo\nfoo", Point{4, 1}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/foo\rnN", "foo\nbar foo\nfoo", Point{4, 1}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/foo\r//\r", "foo\nbar foo\nfoo", Point{0, 2}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/fx\b\bbar\r", "foo\nbar foo\nfoo", Point{0, 1}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/\b/bar\r", "foo\nbar foo\nfoo", Point{0, 1}},
+		{"foo\nbar foo\nfoo", Point{0, 0}, "/\\<o\x1b/o\r", "foo\nbar foo\nfoo", Point{1, 0}},
+		{"one two three", Point{0, 0}, "d/thr\r", "three", Point{0, 0}},
+		{"one two three", Point{12, 0}, "d?two\r", "one e", Point{4, 0}},
+		{"a1 b22 c333", Point{0, 0}, "/\\d\\{2}\r", "a1 b22 c333", Point{4, 0}},
+		{"- foo food foo", Point{0, 0}, "*", "- foo food foo", Point{11, 0}},
+		{"x foo food foo", Point{2, 0}, "*", "x foo food foo", Point{11, 0}},
+		{"x foo food foo", Point{2, 0}, "#", "x foo food foo", Point{11, 0}},
+		{"x foo food foo", Point{12, 0}, "#", "x foo food foo", Point{2, 0}},
+		{"x foo food foo", Point{2, 0}, "*n", "x foo food foo", Point{2, 0}},
+		{"ab\nAB", Point{0, 0}, "/AB/\r", "ab\nAB", Point{0, 1}},
+	}
+	runKeysTests(t, tests, handleKeys, func(vim *Vim, test keysTest) {
+		if vim.SearchPrompt() != "" || len(vim.command) != 0 {
+			t.Errorf("still searching after %q", test.keys)
+		}
+	})
+}
+
+func TestSearchNotFound(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("one two three")
+	handleKeys(t, &vim, buffer, "/two")
+	if vim.SearchPrompt() != "/" {
+		t.Fatalf("unexpected prompt %q while typing a search", vim.SearchPrompt())
+	}
+
+	handleKeys(t, &vim, buffer, "\x1b")
+	if err := vim.HandleKey('n', buffer); err == nil || buffer.Cursor() != (Point{0, 0}) {
+		t.Fatalf("n after an abandoned search moved the cursor to %v, err %v", buffer.Cursor(), err)
+	}
+
+	for _, key := range "d/four\r" {
+		vim.HandleKey(key, buffer)
+	}
+	if err := vim.HandleKey('n', buffer); err == nil || err.Error() != "pattern not found: four" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if StringifyBuffer(buffer) != "one two three\n" || buffer.Cursor() != (Point{0, 0}) {
+		t.Fatalf("a failed search changed the buffer to %q, cursor %v", StringifyBuffer(buffer), buffer.Cursor())
+	}
+}
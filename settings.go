@@ -1,9 +1,173 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type DrawSettings struct {
 	tabWidth int
 }
 
+// how > and < indent lines. a level of indent is a tab, or shiftWidth spaces
+// with expandTab set
+type EditSettings struct {
+	shiftWidth int
+	expandTab  bool
+}
+
 type Settings struct {
-	draw DrawSettings
+	draw   DrawSettings
+	edit   EditSettings
+	search SearchSettings
+	// format of the status line, see FormatStatusLine
+	statusLine string
+	// which Clipboard the + and * registers use, see NewClipboard
+	clipboardProvider string
+
+	// the clipboard last created for clipboardProvider
+	clipboard          Clipboard
+	clipboardCreatedAs string
+}
+
+// an option which can be changed with :set. value points at the setting,
+// which is an *int, *bool or *string
+type option struct {
+	name         string
+	abbreviation string
+	value        interface{}
+}
+
+func (settings *Settings) options() []option {
+	return []option{
+		{"tabstop", "ts", &settings.draw.tabWidth},
+		{"shiftwidth", "sw", &settings.edit.shiftWidth},
+		{"expandtab", "et", &settings.edit.expandTab},
+		{"ignorecase", "ic", &settings.search.ignoreCase},
+		{"smartcase", "scs", &settings.search.smartCase},
+		{"statusline", "stl", &settings.statusLine},
+		{"clipboardprovider", "cbp", &settings.clipboardProvider},
+	}
+}
+
+func (option *option) String() string {
+	switch value := option.value.(type) {
+	case *bool:
+		if *value {
+			return option.name
+		}
+		return "no" + option.name
+	case *int:
+		return fmt.Sprintf("%s=%d", option.name, *value)
+	case *string:
+		return fmt.Sprintf("%s=%s", option.name, *value)
+	}
+	return option.name
+}
+
+func (settings *Settings) findOption(name string) *option {
+	for _, option := range settings.options() {
+		if name == option.name || name == option.abbreviation {
+			return &option
+		}
+	}
+	return nil
+}
+
+// apply a :set argument the way vim does: "name=value" sets an option,
+// "name" turns a boolean option on and "noname" off, "name!" toggles it and
+// "name?" (or "name" for options that aren't boolean) shows it. returns any
+// message to show the user
+func (settings *Settings) Set(arg string) (message string, err error) {
+	name, value := arg, ""
+	assign := strings.IndexAny(arg, "=:")
+	if assign >= 0 {
+		name, value = arg[:assign], arg[assign+1:]
+	}
+
+	query := strings.HasSuffix(name, "?")
+	toggle := strings.HasSuffix(name, "!")
+	name = strings.TrimRight(name, "?!")
+
+	option := settings.findOption(name)
+	off := false
+	if option == nil && strings.HasPrefix(name, "no") {
+		option = settings.findOption(name[2:])
+		off = true
+	}
+	if option == nil {
+		return "", errors.New("unknown option: " + name)
+	}
+	if _, is_bool := option.value.(*bool); (off || toggle) && !is_bool {
+		return "", errors.New("invalid argument: " + arg)
+	}
+
+	if query {
+		return option.String(), nil
+	}
+
+	switch current := option.value.(type) {
+	case *bool:
+		if assign >= 0 {
+			return "", errors.New("invalid argument: " + arg)
+		}
+		if toggle {
+			*current = !*current
+		} else {
+			*current = !off
+		}
+	case *int:
+		if assign < 0 {
+			return option.String(), nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number <= 0 {
+			return "", errors.New("invalid argument: " + arg)
+		}
+		*current = number
+	case *string:
+		if assign < 0 {
+			return option.String(), nil
+		}
+		*current = value
+	}
+	return "", nil
+}
+
+// the clipboard chosen by the clipboardprovider option
+func (settings *Settings) Clipboard() (Clipboard, error) {
+	if settings.clipboard == nil || settings.clipboardCreatedAs != settings.clipboardProvider {
+		clipboard, err := NewClipboard(settings.clipboardProvider)
+		if err != nil {
+			return nil, err
+		}
+		settings.clipboard, settings.clipboardCreatedAs = clipboard, settings.clipboardProvider
+	}
+	return settings.clipboard, nil
+}
+
+// add a level of indent to a line, leaving empty lines empty
+func (settings *EditSettings) Indent(line string) string {
+	if line == "" {
+		return line
+	}
+	if settings.expandTab {
+		return strings.Repeat(" ", settings.shiftWidth) + line
+	}
+	return "\t" + line
+}
+
+// remove a level of indent from a line, which is a tab or up to shiftWidth
+// spaces
+func (settings *EditSettings) Dedent(line string) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	spaces := len(line) - len(strings.TrimLeft(line, " "))
+	if spaces > settings.shiftWidth {
+		spaces = settings.shiftWidth
+	}
+	return line[spaces:]
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"strings"
+	"unicode/utf8"
+)
+
+// the status line format used unless it is changed with :set statusline
+const defaultStatusLine = "%f %m%=%S   %M   %l,%c   %p%%"
+
+// everything the status line can show about the selected view
+type StatusInfo struct {
+	id       int
+	name     string
+	modified bool
+	mode     Mode
+	// line and column (counting from 1) of the cursor, the column is where the
+	// cursor is drawn so tabs count as several columns
+	line    int
+	column  int
+	lines   int
+	command string
+	// the register a macro is being recorded into, 0 if none is
+	recording rune
+}
+
+// expand a status line format the way vim does. the items are %f buffer name,
+// %m "[+]" if modified, %n buffer number, %M mode (and any macro being recorded), %l line, %c column, %L line
+// count, %p percent through file, %S partially typed command, %= pad the rest
+// of the line to the right and %% a literal '%'. the result is padded or cut
+// to width
+func FormatStatusLine(format string, info StatusInfo, width int) string {
+	var left, right []rune
+	side := &left
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			ch, size := utf8.DecodeRuneInString(format[i:])
+			*side = append(*side, ch)
+			i += size - 1
+			continue
+		}
+
+		i++
+		item := ""
+		switch format[i] {
+		default:
+			item = "%" + string(format[i])
+		case '%':
+			item = "%"
+		case 'f':
+			item = info.name
+		case 'm':
+			if info.modified {
+				item = "[+]"
+			}
+		case 'n':
+			item = fmt.Sprintf("%d", info.id)
+		case 'M':
+			item = info.mode.String()
+			if info.recording != 0 {
+				item += fmt.Sprintf(" recording @%c", info.recording)
+			}
+		case 'l':
+			item = fmt.Sprintf("%d", info.line)
+		case 'c':
+			item = fmt.Sprintf("%d", info.column)
+		case 'L':
+			item = fmt.Sprintf("%d", info.lines)
+		case 'p':
+			percent := 0
+			if info.lines > 0 {
+				percent = info.line * 100 / info.lines
+			}
+			item = fmt.Sprintf("%d", percent)
+		case 'S':
+			item = info.command
+		case '=':
+			side = &right
+		}
+		*side = append(*side, []rune(item)...)
+	}
+
+	// the right side wins if there isn't room for both
+	if len(right) > width {
+		right = right[len(right)-width:]
+	}
+	if len(left)+len(right) > width {
+		left = left[:width-len(right)]
+	}
+	padding := strings.Repeat(" ", width-len(left)-len(right))
+	return string(left) + padding + string(right)
+}
+
+// collect what the status line shows about a view
+func (editor *Editor) StatusInfo(view *View) (info StatusInfo) {
+	if entry := editor.buffers.Find(view.buffer); entry != nil {
+		info.id = entry.id
+		info.name = entry.Name()
+		info.modified = entry.Modified()
+	}
+
+	info.mode = editor.vim.mode
+	info.command = string(editor.vim.command)
+	info.recording = editor.vim.recording
+	info.lines = len(view.buffer.Lines())
+	if info.lines > 0 {
+		cursor := view.Cursor()
+		info.line = cursor.y + 1
+		info.column = PrintableCursor(view.buffer, cursor, &editor.settings.draw).x + 1
+	}
+	return
+}
+
+// draw the status line for the selected view on the given terminal row
+func (editor *Editor) DrawStatusLine(row int, terminal_dimensions Point) {
+	view := editor.SelectedView()
+	if view == nil || view.buffer == nil {
+		return
+	}
+
+	status := FormatStatusLine(editor.settings.statusLine, editor.StatusInfo(view), terminal_dimensions.x)
+	drawLine(row, status, termbox.ColorDefault|termbox.AttrReverse, terminal_dimensions)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatStatusLine(t *testing.T) {
+	info := StatusInfo{id: 2, name: "main.go", modified: true, mode: MODE_INSERT, line: 5, column: 9, lines: 20, command: "d"}
+
+	status := FormatStatusLine("%f %m%=%S %M %l,%c %p%%", info, 40)
+	if expected := "main.go [+]" + strings.Repeat(" ", 13) + "d INSERT 5,9 25%"; status != expected {
+		t.Fatalf("got '%s', expected '%s'", status, expected)
+	}
+
+	// the left side is cut to make room for the right
+	status = FormatStatusLine("%n:%f%=%L", info, 8)
+	if expected := "2:main20"; status != expected {
+		t.Fatalf("got '%s', expected '%s'", status, expected)
+	}
+}
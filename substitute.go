@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// :[range]s/pattern/replacement/[flags] [count] replaces matches of a vim
+// pattern on each line of the range, the current line by default. the flags
+// are g to replace every match on a line rather than the first, c to confirm
+// each replacement, i and I to ignore or match case, n to count the matches
+// instead of replacing them and e to not complain when there are none. any
+// character other than a letter, digit, space, '\', '"' or '|' can stand in
+// for the '/'. everything replaced is undone together
+
+// the parts of a substitute command
+type substituteArgs struct {
+	pattern     string
+	replacement string
+	flags       string
+	// the number of lines to work on from the last line of the range, 0 for
+	// the range as it is
+	count int
+}
+
+// a substitution working through the matches in a range of lines, which waits
+// for each to be confirmed while the editor's substitution is set
+type substitution struct {
+	buffer      Buffer
+	undoer      Undoer
+	re          *regexp.Regexp
+	pattern     string
+	replacement string
+	// the g, c, n and e flags
+	global     bool
+	confirm    bool
+	count_only bool
+	quiet      bool
+
+	// the line being worked on and the last line of the range, which moves
+	// down as replacements break lines
+	y    int
+	last int
+	// the matches on the line and the next to replace. the line is rewritten
+	// into text, which has had the line up to copied added to it so far
+	matches [][]int
+	next    int
+	text    string
+	copied  int
+	changed bool
+
+	// replacements made (or counted) and skipped, the lines they were on and
+	// the last of them, and where the cursor was before the substitution
+	count        int
+	skipped      int
+	lines        int
+	last_changed int
+	cursor       Point
+}
+
+// split a substitute command's argument into its parts. ok is false when the
+// argument is empty, which repeats the last substitution
+func splitSubstitute(arg string) (args substituteArgs, ok bool, err error) {
+	arg = strings.TrimLeft(arg, " \t")
+	if arg == "" {
+		return args, false, nil
+	}
+
+	delimiter, rest, err := splitDelimiter(arg)
+	if err != nil {
+		return args, false, err
+	}
+	args.pattern, rest = splitDelimited(rest, delimiter)
+	args.replacement, rest = splitDelimited(rest, delimiter)
+
+	flags := 0
+	for flags < len(rest) && strings.IndexByte("gcinIe", rest[flags]) >= 0 {
+		flags++
+	}
+	args.flags, rest = rest[:flags], strings.TrimLeft(rest[flags:], " \t")
+
+	if digits := numberPrefix(rest); digits > 0 {
+		args.count, _ = strconv.Atoi(rest[:digits])
+		rest = rest[digits:]
+	}
+	if strings.TrimSpace(rest) != "" {
+		return args, false, errors.New("trailing characters: " + rest)
+	}
+	return args, true, nil
+}
+
+// the character at the start of arg which separates a pattern from what
+// follows it, and the text after it
+func splitDelimiter(arg string) (rune, string, error) {
+	delimiter, size := utf8.DecodeRuneInString(arg)
+	if unicode.IsLetter(delimiter) || unicode.IsDigit(delimiter) || strings.ContainsRune(" \\\"|", delimiter) {
+		return delimiter, arg, errors.New("invalid delimiter: " + string(delimiter))
+	}
+	return delimiter, arg[size:], nil
+}
+
+// the text before the first delimiter not escaped with a backslash, and the
+// text after it
+func splitDelimited(text string, delimiter rune) (string, string) {
+	escaped := false
+	for i, ch := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\':
+			escaped = true
+		case ch == delimiter:
+			return text[:i], text[i+utf8.RuneLen(ch):]
+		}
+	}
+	return text, ""
+}
+
+// the text a match on line is replaced with. & and \0 are the whole match, \1
+// to \9 its groups, \r and \n break the line and \t is a tab. \u and \l make
+// the next character upper or lower case, \U and \L everything up to \e or \E,
+// and any other character after a backslash is itself
+func expandReplacement(replacement string, line string, match []int) string {
+	var out strings.Builder
+	var next_case, case_until_end rune
+	emit := func(text string) {
+		for _, ch := range text {
+			switch {
+			case next_case == 'u', next_case == 0 && case_until_end == 'U':
+				ch = unicode.ToUpper(ch)
+			case next_case == 'l', next_case == 0 && case_until_end == 'L':
+				ch = unicode.ToLower(ch)
+			}
+			next_case = 0
+			out.WriteRune(ch)
+		}
+	}
+	group := func(n int) string {
+		if 2*n+1 < len(match) && match[2*n] >= 0 {
+			return line[match[2*n]:match[2*n+1]]
+		}
+		return ""
+	}
+
+	runes := []rune(replacement)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		if ch == '&' {
+			emit(group(0))
+			continue
+		}
+		if ch != '\\' || i+1 == len(runes) {
+			emit(string(ch))
+			continue
+		}
+
+		i++
+		ch = runes[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			emit(group(int(ch - '0')))
+		case ch == 'r' || ch == 'n':
+			out.WriteRune('\n')
+		case ch == 't':
+			emit("\t")
+		case ch == 'u' || ch == 'l':
+			next_case = ch
+		case ch == 'U' || ch == 'L':
+			case_until_end = ch
+		case ch == 'e' || ch == 'E':
+			case_until_end = 0
+		default:
+			emit(string(ch))
+		}
+	}
+	return out.String()
+}
+
+func substituteCommand(editor *Editor, view *View, lines LineRange, arg string, force bool) error {
+	args, ok, err := splitSubstitute(arg)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if editor.last_substitute.pattern == "" {
+			return errors.New("no previous substitute")
+		}
+		args = substituteArgs{pattern: editor.last_substitute.pattern, replacement: editor.last_substitute.replacement}
+	}
+
+	vim := &editor.vim
+	if args.pattern == "" {
+		args.pattern = vim.last_search.pattern
+		if args.pattern == "" {
+			return errors.New("no previous regular expression")
+		}
+	}
+	editor.last_substitute = args
+	if vim.last_search.pattern == "" {
+		vim.last_search.forward = true
+	}
+	vim.last_search.pattern = args.pattern
+
+	if strings.Contains(args.flags, "c") && editor.in_global {
+		return errors.New("cannot confirm substitutions made by :global")
+	}
+	if args.count > 0 {
+		lines.start = lines.end
+		lines.end = Clamp(lines.end+args.count-1, lines.start, len(view.buffer.Lines())-1)
+	}
+
+	s, err := newSubstitution(view.buffer, args, lines, &editor.settings.search)
+	if err != nil {
+		return err
+	}
+	if !s.confirm {
+		for s.pending() {
+			if err = s.answer(true); err != nil {
+				break
+			}
+		}
+		return editor.finishSubstitution(s, err)
+	}
+
+	if !s.pending() {
+		return editor.finishSubstitution(s, nil)
+	}
+	editor.substitution = s
+	return editor.promptSubstitution()
+}
+
+func newSubstitution(buffer Buffer, args substituteArgs, lines LineRange, settings *SearchSettings) (*substitution, error) {
+	// i and I override the ignorecase and smartcase options
+	search_settings := *settings
+	if strings.Contains(args.flags, "i") {
+		search_settings = SearchSettings{ignoreCase: true}
+	}
+	if strings.Contains(args.flags, "I") {
+		search_settings = SearchSettings{}
+	}
+	re, err := CompileSearch(args.pattern, &search_settings)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &substitution{
+		buffer:      buffer,
+		re:          re,
+		pattern:     args.pattern,
+		replacement: args.replacement,
+		global:      strings.Contains(args.flags, "g"),
+		confirm:     strings.Contains(args.flags, "c"),
+		count_only:  strings.Contains(args.flags, "n"),
+		quiet:       strings.Contains(args.flags, "e"),
+		y:           lines.start,
+		last:        lines.end,
+		cursor:      buffer.Cursor(),
+	}
+	if undoer, ok := buffer.(Undoer); ok && !s.count_only {
+		undoer.StartChange()
+		s.undoer = undoer
+	}
+	s.findMatches()
+	return s, nil
+}
+
+// returns true while there is a match waiting to be replaced or skipped
+func (s *substitution) pending() bool {
+	return s.y <= s.last && s.next < len(s.matches)
+}
+
+// the start of the match waiting to be replaced or skipped
+func (s *substitution) match() Point {
+	return Point{s.matches[s.next][0], s.y}
+}
+
+// find the matches on the line being worked on, or the first line after it
+// in the range with any
+func (s *substitution) findMatches() {
+	for ; s.y <= s.last; s.y++ {
+		s.matches = s.re.FindAllStringSubmatchIndex(s.buffer.Lines()[s.y], -1)
+		if len(s.matches) > 0 && !s.global {
+			s.matches = s.matches[:1]
+		}
+		if len(s.matches) > 0 {
+			s.next, s.text, s.copied, s.changed = 0, "", 0, false
+			return
+		}
+	}
+}
+
+// replace the waiting match, or skip it, and move on to the next
+func (s *substitution) answer(replace bool) (err error) {
+	if replace {
+		if !s.changed {
+			s.lines++
+			s.changed = true
+		}
+		s.count++
+
+		line := s.buffer.Lines()[s.y]
+		match := s.matches[s.next]
+		s.text += line[s.copied:match[0]] + expandReplacement(s.replacement, line, match)
+		s.copied = match[1]
+	} else {
+		s.skipped++
+	}
+
+	s.next++
+	if s.next < len(s.matches) {
+		return
+	}
+	err = s.finishLine()
+	s.y++
+	s.findMatches()
+	return
+}
+
+// write the rewritten line, breaking it where replacements put line breaks
+func (s *substitution) finishLine() (err error) {
+	if !s.changed || s.count_only {
+		return
+	}
+
+	line := s.buffer.Lines()[s.y]
+	pieces := strings.Split(s.text+line[s.copied:], "\n")
+	if err = SetLine(s.buffer, s.y, pieces[0]); err != nil {
+		return
+	}
+	for _, piece := range pieces[1:] {
+		s.y++
+		s.last++
+		if err = InsertLine(s.buffer, s.y, piece); err != nil {
+			return
+		}
+	}
+	s.last_changed = s.y
+	return
+}
+
+// stop substituting, finishing the line being worked on, and report how many
+// matches were replaced
+func (editor *Editor) finishSubstitution(s *substitution, err error) error {
+	editor.substitution = nil
+	if s.y <= s.last && err == nil {
+		err = s.finishLine()
+	}
+
+	cursor := s.cursor
+	if s.lines > 0 && !s.count_only {
+		line := s.buffer.Lines()[s.last_changed]
+		cursor = Point{firstNonBlank(line), s.last_changed}
+	}
+	s.buffer.SetCursor(ClampIn(s.buffer, cursor))
+	if s.undoer != nil {
+		if commit_err := s.undoer.Commit(); err == nil {
+			err = commit_err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case s.count == 0 && s.skipped == 0 && !s.quiet:
+		return errors.New(fmt.Sprintf("pattern not found: %s", s.pattern))
+	case s.count_only:
+		editor.command_line.ShowMessage(fmt.Sprintf("%s on %s", plural(s.count, "match", "matches"), plural(s.lines, "line", "lines")))
+	case s.count > 1:
+		editor.command_line.ShowMessage(fmt.Sprintf("%s on %s", plural(s.count, "substitution", "substitutions"), plural(s.lines, "line", "lines")))
+	}
+	return nil
+}
+
+// move to the next match to confirm and ask whether to replace it
+func (editor *Editor) promptSubstitution() error {
+	s := editor.substitution
+	if err := s.buffer.SetCursor(s.match()); err != nil {
+		return err
+	}
+	editor.command_line.ShowMessage(fmt.Sprintf("replace with %s (y/n/a/q/l)?", s.replacement))
+	return nil
+}
+
+// answer the confirmation of the waiting match. y replaces it and n skips it,
+// a replaces it and every match after it, l replaces it and stops, and q or
+// escape stop
+func (editor *Editor) ConfirmSubstitution(key rune) (err error) {
+	s := editor.substitution
+	switch key {
+	case 'y', 'n':
+		err = s.answer(key == 'y')
+	case 'a':
+		for s.pending() && err == nil {
+			err = s.answer(true)
+		}
+	case 'l':
+		err = s.answer(true)
+		return editor.finishSubstitution(s, err)
+	case 'q', KEY_ESCAPE, KEY_CTRL_C:
+		return editor.finishSubstitution(s, nil)
+	default:
+		return editor.promptSubstitution()
+	}
+
+	if err != nil || !s.pending() {
+		return editor.finishSubstitution(s, err)
+	}
+	return editor.promptSubstitution()
+}
+
+// a count with the singular or plural noun for it
+func plural(count int, singular string, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		contents string
+		line     int
+		command  string
+		expected string
+		cursor   Point
+	}{
+		{"a a\na a", 0, "s/a/b/", "b a\na a", Point{0, 0}},
+		{"a a\na a", 0, "s/a/b/g", "b b\na a", Point{0, 0}},
+		{"a a\na a", 1, "%s/a/b/", "b a\nb a", Point{0, 1}},
+		{"a\na\na\na", 0, ".,+2s/a/b/", "b\nb\nb\na", Point{0, 2}},
+		{"a\na\na\na", 3, "2,3s/a/b/", "a\nb\nb\na", Point{0, 2}},
+		{"a\na\na\na", 0, "s/a/b/ 2", "b\nb\na\na", Point{0, 1}},
+		{"a\na\na\na", 0, "$s#a#b#", "a\na\na\nb", Point{0, 3}},
+		{"key = value", 0, `s/\(\w\+\) = \(\w\+\)/\2 = \1/`, "value = key", Point{0, 0}},
+		{"key = value", 0, `s/\v(\w+) \= (\w+)/\2: \1/`, "value: key", Point{0, 0}},
+		{"foo bar", 0, `s/\w\+/[&]/g`, "[foo] [bar]", Point{0, 0}},
+		{"foo bar", 0, `s/\w\+/\u&/g`, "Foo Bar", Point{0, 0}},
+		{"foo bar", 0, `s/foo/\U&\E!/`, "FOO! bar", Point{0, 0}},
+		{"a,b,c", 0, `s/,/\r/g`, "a\nb\nc", Point{0, 2}},
+		{"a,b\nc,d", 0, `%s/,/\r/`, "a\nb\nc\nd", Point{0, 3}},
+		{"a/b", 0, `s/\//-/`, "a-b", Point{0, 0}},
+		{"aXa", 0, "s/x/-/i", "a-a", Point{0, 0}},
+		{"abc", 0, "s/x*/-/g", "-a-b-c-", Point{0, 0}},
+		{"  indented", 0, "s/in/IN/", "  INdented", Point{2, 0}},
+	}
+	for _, test := range tests {
+		editor, view := newTestEditor(test.contents, test.line)
+		if err := runTestCommand(editor, view, test.command); err != nil {
+			t.Errorf("%q on %q: %v", test.command, test.contents, err)
+			continue
+		}
+		if StringifyBuffer(view.buffer) != test.expected+"\n" || view.Cursor() != test.cursor {
+			t.Errorf("%q cursor %v after %q on %q, expected %q cursor %v",
+				StringifyBuffer(view.buffer), view.Cursor(), test.command, test.contents, test.expected, test.cursor)
+		}
+	}
+}
+
+func TestSubstituteErrors(t *testing.T) {
+	for _, command := range []string{"s/x/y/", "s", "s/a/b/q", "sxaxbx", "s/\\(/x/"} {
+		editor, view := newTestEditor("a", 0)
+		if err := runTestCommand(editor, view, command); err == nil {
+			t.Errorf("%q should fail", command)
+		}
+	}
+
+	editor, view := newTestEditor("a", 0)
+	if err := runTestCommand(editor, view, "s/x/y/e"); err != nil {
+		t.Errorf("e should hide pattern not found: %v", err)
+	}
+}
+
+func TestSubstituteRepeat(t *testing.T) {
+	editor, view := newTestEditor("a a a\na", 0)
+	for _, command := range []string{"s/a/b/", "s", "2s"} {
+		if err := runTestCommand(editor, view, command); err != nil {
+			t.Fatalf("%q: %v", command, err)
+		}
+	}
+	if StringifyBuffer(view.buffer) != "b b a\nb\n" {
+		t.Fatalf("unexpected buffer %q", StringifyBuffer(view.buffer))
+	}
+
+	// an empty pattern is the last search
+	view.Activate()
+	handleKeys(t, &editor.vim, view.buffer, "/a\r")
+	view.Deactivate()
+	if err := runTestCommand(editor, view, "s//c/"); err != nil || StringifyBuffer(view.buffer) != "b b c\nb\n" {
+		t.Fatalf("unexpected buffer %q, err %v", StringifyBuffer(view.buffer), err)
+	}
+}
+
+func TestSubstituteCount(t *testing.T) {
+	editor, view := newTestEditor("a a\nb\na", 0)
+	if err := runTestCommand(editor, view, "%s/a//gn"); err != nil {
+		t.Fatal(err)
+	}
+	if editor.command_line.message != "3 matches on 2 lines" || StringifyBuffer(view.buffer) != "a a\nb\na\n" {
+		t.Fatalf("unexpected message %q, buffer %q", editor.command_line.message, StringifyBuffer(view.buffer))
+	}
+}
+
+func TestSubstituteUndo(t *testing.T) {
+	lines := make([]string, 5000)
+	for i := range lines {
+		lines[i] = "DEBUG line"
+	}
+	contents := strings.Join(lines, "\n")
+	editor, view := newTestEditor(contents, 0)
+	if err := runTestCommand(editor, view, `%s/DEBUG/INFO\r/`); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.buffer.Lines()) != 10000 || view.buffer.Lines()[9999] != " line" {
+		t.Fatalf("unexpected %d lines", len(view.buffer.Lines()))
+	}
+
+	undoer := view.buffer.(Undoer)
+	undoer.Undo()
+	if StringifyBuffer(view.buffer) != contents+"\n" {
+		t.Fatal("a single undo should undo the whole substitution")
+	}
+}
+
+func TestSubstituteConfirm(t *testing.T) {
+	tests := []struct {
+		contents string
+		command  string
+		answers  string
+		expected string
+	}{
+		{"a a\na", "%s/a/b/gc", "yny", "b a\nb"},
+		{"a a\na", "%s/a/b/gc", "nyy", "a b\nb"},
+		{"a a\na", "%s/a/b/gc", "na", "a b\nb"},
+		{"a a\na", "%s/a/b/gc", "yq", "b a\na"},
+		{"a a\na", "%s/a/b/gc", "nl", "a b\na"},
+		{"a a\na", "%s/a/b/gc", "y\x1b", "b a\na"},
+	}
+	for _, test := range tests {
+		editor, view := newTestEditor(test.contents, 0)
+		if err := runTestCommand(editor, view, test.command); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range test.answers {
+			if editor.substitution == nil {
+				t.Fatalf("%q stopped confirming before %q", test.answers, key)
+			}
+			view.Activate()
+			if err := editor.ConfirmSubstitution(key); err != nil {
+				t.Fatal(err)
+			}
+			view.Deactivate()
+		}
+		if editor.substitution != nil || StringifyBuffer(view.buffer) != test.expected+"\n" {
+			t.Errorf("%q after answering %q on %q, expected %q", StringifyBuffer(view.buffer), test.answers, test.contents, test.expected)
+		}
+
+		view.buffer.(Undoer).Undo()
+		if StringifyBuffer(view.buffer) != test.contents+"\n" {
+			t.Errorf("%q after undoing %q", StringifyBuffer(view.buffer), test.answers)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// text objects select the text around the cursor rather than moving it, such
+// as the word or the brackets the cursor is in. after i they select the inner
+// object, after a the object and what surrounds it: the white space after a
+// word or string, or the brackets and tags themselves. when there is no object
+// around the cursor the range is empty and the error stops the action
+
+// i and a start a text object, which is passed on to the object in the
+// motion's parameter
+func parsePrefixTextObject(action *Action, prefix rune) ParseActionState {
+	action.prefix = prefix
+	action.motion.param = string(prefix)
+	return PARSE_ACTION_STATE_IN_PROGRESS
+}
+
+func parseObjectWord(action *Action) ParseActionState {
+	return parseTextObject(action, objectWord)
+}
+
+func parseObjectBigWord(action *Action) ParseActionState {
+	return parseTextObject(action, objectBigWord)
+}
+
+func parseObjectDoubleQuote(action *Action) ParseActionState {
+	return parseTextObject(action, objectDoubleQuote)
+}
+
+func parseObjectSingleQuote(action *Action) ParseActionState {
+	return parseTextObject(action, objectSingleQuote)
+}
+
+func parseObjectBackQuote(action *Action) ParseActionState {
+	return parseTextObject(action, objectBackQuote)
+}
+
+func parseObjectParens(action *Action) ParseActionState {
+	return parseTextObject(action, objectParens)
+}
+
+func parseObjectBraces(action *Action) ParseActionState {
+	return parseTextObject(action, objectBraces)
+}
+
+func parseObjectBrackets(action *Action) ParseActionState {
+	return parseTextObject(action, objectBrackets)
+}
+
+func parseObjectAngleBrackets(action *Action) ParseActionState {
+	return parseTextObject(action, objectAngleBrackets)
+}
+
+func parseObjectParagraph(action *Action) ParseActionState {
+	return parseTextObject(action, objectParagraph)
+}
+
+func parseObjectTag(action *Action) ParseActionState {
+	return parseTextObject(action, objectTag)
+}
+
+// the object is the operator's motion, or extends the selection in visual mode
+func parseTextObject(action *Action, object MotionFunc) ParseActionState {
+	action.motion.function = object
+	if isVisual(action.mode) {
+		action.verb.function = verbSelectObject
+	}
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// returns true for the inner object, typed after i
+func isInner(action *Action) bool {
+	return action.motion.param == "i"
+}
+
+// select a text object. objects made of whole lines select lines
+func verbSelectObject(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if r.linewise {
+		if vim.mode == MODE_VISUAL_RANGE {
+			vim.mode = MODE_VISUAL_LINE
+		}
+		vim.visual_start = Point{0, r.start.y}
+		return buffer.SetCursor(Point{0, r.end.y})
+	}
+	if r.start == r.end {
+		return
+	}
+
+	vim.visual_start = r.start
+	last, _ := prevPoint(buffer, r.end)
+	return buffer.SetCursor(ClampIn(buffer, last))
+}
+
+func objectWord(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return wordObject(vim, action, buffer, false)
+}
+
+func objectBigWord(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return wordObject(vim, action, buffer, true)
+}
+
+// words and the runs of white space between them on the cursor's line, each
+// of which counts for iw. aw counts words with the white space after them, or
+// the white space before the first when the cursor is on white space. a word
+// without white space after it takes the white space before it instead
+func wordObject(vim *Vim, action *Action, buffer Buffer, bigword bool) (r Range) {
+	cursor := ClampIn(buffer, buffer.Cursor())
+	y := cursor.y
+	line := buffer.Lines()[y]
+	if line == "" {
+		return noObject(vim, cursor)
+	}
+	blank := func(x int) bool {
+		return x < len(line) && charClass(buffer, Point{x, y}, bigword) == CHAR_CLASS_BLANK
+	}
+	next := func(x int) int {
+		_, end := classRun(buffer, Point{x, y}, bigword)
+		return end
+	}
+
+	start, end := classRun(buffer, cursor, bigword)
+	if isInner(action) {
+		for i := 1; i < action.Count() && end < len(line); i++ {
+			end = next(end)
+		}
+		return Range{start: Point{start, y}, end: Point{end, y}}
+	}
+
+	on_blank := blank(cursor.x)
+	trailing := false
+	for i := 0; i < action.Count(); i++ {
+		if i > 0 {
+			if end >= len(line) {
+				break
+			}
+			end = next(end)
+		}
+		if on_blank {
+			if end < len(line) {
+				end = next(end)
+			}
+		} else {
+			trailing = blank(end)
+			if trailing {
+				end = next(end)
+			}
+		}
+	}
+
+	if !on_blank && !trailing && start > 0 {
+		if before, _ := prevPoint(buffer, Point{start, y}); blank(before.x) {
+			start, _ = classRun(buffer, before, bigword)
+		}
+	}
+	return Range{start: Point{start, y}, end: Point{end, y}}
+}
+
+// the run of characters on p's line in the same class as the one at p, from
+// its start to just after its end
+func classRun(buffer Buffer, p Point, bigword bool) (start int, end int) {
+	line := buffer.Lines()[p.y]
+	class := charClass(buffer, p, bigword)
+	start, end = p.x, p.x
+	for start > 0 {
+		before, _ := prevPoint(buffer, Point{start, p.y})
+		if charClass(buffer, before, bigword) != class {
+			break
+		}
+		start = before.x
+	}
+	for end < len(line) && charClass(buffer, Point{end, p.y}, bigword) == class {
+		after, _ := nextPoint(buffer, Point{end, p.y})
+		end = after.x
+	}
+	return
+}
+
+func objectDoubleQuote(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return quoteObject(vim, action, buffer, '"')
+}
+
+func objectSingleQuote(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return quoteObject(vim, action, buffer, '\'')
+}
+
+func objectBackQuote(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return quoteObject(vim, action, buffer, '`')
+}
+
+// the quoted string on the cursor's line which the cursor is in, or else the
+// first one after it. quotes escaped with a backslash don't count
+func quoteObject(vim *Vim, action *Action, buffer Buffer, quote byte) (r Range) {
+	cursor := ClampIn(buffer, buffer.Cursor())
+	line := buffer.Lines()[cursor.y]
+
+	var quotes []int
+	for x := 0; x < len(line); x++ {
+		if line[x] == '\\' {
+			x++
+		} else if line[x] == quote {
+			quotes = append(quotes, x)
+		}
+	}
+	open, close, ok := quotePair(quotes, cursor.x)
+	if !ok {
+		return noObject(vim, cursor)
+	}
+
+	if isInner(action) {
+		return Range{start: Point{open + 1, cursor.y}, end: Point{close, cursor.y}}
+	}
+	start, end := open, close+1
+	if trailing := len(strings.TrimLeft(line[end:], " \t")); trailing < len(line)-end {
+		end = len(line) - trailing
+	} else {
+		start = len(strings.TrimRight(line[:start], " \t"))
+	}
+	return Range{start: Point{start, cursor.y}, end: Point{end, cursor.y}}
+}
+
+// the quotes at either end of the string at x. on a quote, quotes pair up
+// from the start of the line
+func quotePair(quotes []int, x int) (open int, close int, ok bool) {
+	before := -1
+	for i, quote := range quotes {
+		switch {
+		case quote == x && i%2 == 1:
+			return quotes[i-1], quote, true
+		case quote == x, quote > x && before < 0:
+			if i+1 < len(quotes) {
+				return quote, quotes[i+1], true
+			}
+			return 0, 0, false
+		case quote > x:
+			return before, quote, true
+		}
+		before = quote
+	}
+	return 0, 0, false
+}
+
+func objectParens(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return bracketObject(vim, action, buffer, '(', ')')
+}
+
+func objectBraces(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return bracketObject(vim, action, buffer, '{', '}')
+}
+
+func objectBrackets(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return bracketObject(vim, action, buffer, '[', ']')
+}
+
+func objectAngleBrackets(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return bracketObject(vim, action, buffer, '<', '>')
+}
+
+// the text in the brackets around the cursor, count levels out. when the
+// brackets are on lines of their own the inner object is the lines between
+func bracketObject(vim *Vim, action *Action, buffer Buffer, open rune, close rune) (r Range) {
+	cursor := ClampIn(buffer, buffer.Cursor())
+	start, ok := enclosingBracket(buffer, cursor, open, close, action.Count())
+	if !ok {
+		return noObject(vim, cursor)
+	}
+	end, ok := matchingBracket(buffer, start, open, close)
+	if !ok {
+		return noObject(vim, cursor)
+	}
+
+	if !isInner(action) {
+		r.start = start
+		r.end, _ = nextPoint(buffer, end)
+		return r
+	}
+
+	lines := buffer.Lines()
+	if start.x+utf8.RuneLen(open) == len(lines[start.y]) && end.y > start.y+1 && strings.TrimSpace(lines[end.y][:end.x]) == "" {
+		return Range{start: Point{0, start.y + 1}, end: Point{0, end.y - 1}, linewise: true}
+	}
+	r.start, _ = nextPoint(buffer, start)
+	r.end = end
+	return r
+}
+
+// the open bracket count levels out from p. a bracket under p counts as one
+// the cursor is in
+func enclosingBracket(buffer Buffer, p Point, open rune, close rune, count int) (Point, bool) {
+	ok := true
+	if runeAt(buffer, p) == close {
+		p, ok = prevPoint(buffer, p)
+	}
+
+	depth := 0
+	for ; ok; p, ok = prevPoint(buffer, p) {
+		switch runeAt(buffer, p) {
+		case close:
+			depth++
+		case open:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			count--
+			if count == 0 {
+				return p, true
+			}
+		}
+	}
+	return p, false
+}
+
+// the close bracket for the open bracket at p
+func matchingBracket(buffer Buffer, p Point, open rune, close rune) (Point, bool) {
+	depth := 0
+	for p, ok := nextPoint(buffer, p); ok; p, ok = nextPoint(buffer, p) {
+		switch runeAt(buffer, p) {
+		case open:
+			depth++
+		case close:
+			if depth == 0 {
+				return p, true
+			}
+			depth--
+		}
+	}
+	return p, false
+}
+
+// the character at p, '\n' for the line break at the end of a line
+func runeAt(buffer Buffer, p Point) rune {
+	line := buffer.Lines()[p.y]
+	if p.x >= len(line) {
+		return '\n'
+	}
+	ch, _ := utf8.DecodeRuneInString(line[p.x:])
+	return ch
+}
+
+// a paragraph is a run of lines which aren't blank, and the blank lines
+// between paragraphs count as one too for ip. ap takes the blank lines after
+// a paragraph, or before it if there are none after
+func objectParagraph(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	lines := buffer.Lines()
+	blank := func(y int) bool {
+		return strings.TrimSpace(lines[y]) == ""
+	}
+	// the first and last lines of the run y is in
+	run := func(y int) (top int, bottom int) {
+		top, bottom = y, y
+		for top > 0 && blank(top-1) == blank(y) {
+			top--
+		}
+		for bottom+1 < len(lines) && blank(bottom+1) == blank(y) {
+			bottom++
+		}
+		return
+	}
+
+	y := buffer.Cursor().y
+	top, bottom := run(y)
+	runs := action.Count()
+	if !isInner(action) {
+		runs *= 2
+	}
+	for i := 1; i < runs && bottom+1 < len(lines); i++ {
+		_, bottom = run(bottom + 1)
+	}
+	if !isInner(action) && !blank(y) && !blank(bottom) && top > 0 {
+		top, _ = run(top - 1)
+	}
+	return Range{start: Point{0, top}, end: Point{0, bottom}, linewise: true}
+}
+
+var tagPattern = regexp.MustCompile(`<(/?)([^\s/>]+)[^>]*?(/?)>`)
+
+// the text between the xml or html tags around the cursor, count levels out,
+// and the tags as well for at
+func objectTag(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	cursor := ClampIn(buffer, buffer.Cursor())
+	lines := buffer.Lines()
+	text := strings.Join(lines, "\n")
+	offset := textOffset(lines, cursor)
+
+	type tag struct {
+		name  string
+		start int
+		end   int
+	}
+	// the tags still open, and the pairs of tags around the cursor from the
+	// innermost out
+	var open []tag
+	var around [][2]tag
+	for _, match := range tagPattern.FindAllStringSubmatchIndex(text, -1) {
+		current := tag{text[match[4]:match[5]], match[0], match[1]}
+		switch {
+		case match[7] > match[6]:
+			// closes itself
+		case match[3] > match[2]:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i].name != current.name {
+					continue
+				}
+				if open[i].start <= offset && offset < current.end {
+					around = append(around, [2]tag{open[i], current})
+				}
+				open = open[:i]
+				break
+			}
+		default:
+			open = append(open, current)
+		}
+	}
+	if len(around) < action.Count() {
+		return noObject(vim, cursor)
+	}
+
+	pair := around[action.Count()-1]
+	if isInner(action) {
+		return Range{start: textPoint(lines, pair[0].end), end: textPoint(lines, pair[1].start)}
+	}
+	return Range{start: textPoint(lines, pair[0].start), end: textPoint(lines, pair[1].end)}
+}
+
+// the empty range at the cursor for an object which isn't there, with the
+// error which stops the action
+func noObject(vim *Vim, cursor Point) Range {
+	vim.motion_err = errors.New("no text object at the cursor")
+	return Range{start: cursor, end: cursor}
+}
+
+// the offset of p in the lines joined by line breaks
+func textOffset(lines []string, p Point) int {
+	offset := p.x
+	for _, line := range lines[:p.y] {
+		offset += len(line) + 1
+	}
+	return offset
+}
+
+// the point at an offset in the lines joined by line breaks
+func textPoint(lines []string, offset int) Point {
+	for y, line := range lines {
+		if offset <= len(line) {
+			return Point{offset, y}
+		}
+		offset -= len(line) + 1
+	}
+	last := len(lines) - 1
+	return Point{len(lines[last]), last}
+}
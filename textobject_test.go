@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTextObjects(t *testing.T) {
+	tests := []keysTest{
+		{"foo bar baz", Point{5, 0}, "diw", "foo  baz", Point{4, 0}},
+		{"foo bar baz", Point{5, 0}, "daw", "foo baz", Point{4, 0}},
+		{"foo bar", Point{5, 0}, "daw", "foo", Point{2, 0}},
+		{"foo bar baz", Point{3, 0}, "daw", "foo baz", Point{3, 0}},
+		{"foo bar baz", Point{0, 0}, "d2aw", "baz", Point{0, 0}},
+		{"foo bar baz", Point{0, 0}, "d3iw", " baz", Point{0, 0}},
+		{"a.b-c d", Point{0, 0}, "diW", " d", Point{0, 0}},
+		{`say "hi there" now`, Point{6, 0}, "ci\"yo\x1b", `say "yo" now`, Point{6, 0}},
+		{`say "hi" now`, Point{6, 0}, "da\"", `say now`, Point{4, 0}},
+		{`x = "a\"b"`, Point{0, 0}, "di\"", `x = ""`, Point{5, 0}},
+		{`it's 'a'`, Point{6, 0}, "di'", `it's ''`, Point{6, 0}},
+		{"f(a, (b), c)", Point{2, 0}, "di(", "f()", Point{2, 0}},
+		{"f(a, (b), c)", Point{6, 0}, "d2ib", "f()", Point{2, 0}},
+		{"f(a, (b), c)", Point{7, 0}, "da)", "f(a, , c)", Point{5, 0}},
+		{"if x {\n\tfoo\n\tbar\n}", Point{1, 1}, "di{", "if x {\n}", Point{0, 1}},
+		{"if x {\n\tfoo\n}", Point{1, 1}, "ciBbar\x1b", "if x {\nbar\n}", Point{2, 1}},
+		{"a[1]", Point{2, 0}, "ci]2\x1b", "a[2]", Point{2, 0}},
+		{"x<ab>y", Point{2, 0}, "di<", "x<>y", Point{2, 0}},
+		{"a\nb\n\nc\nd", Point{0, 0}, "dap", "c\nd", Point{0, 0}},
+		{"a\nb\n\nc\nd", Point{0, 3}, "dap", "a\nb", Point{0, 1}},
+		{"a\nb\n\nc\nd", Point{0, 0}, "dip", "\nc\nd", Point{0, 0}},
+		{"<div><b>x</b> y</div>", Point{8, 0}, "dit", "<div><b></b> y</div>", Point{8, 0}},
+		{"<div><b>x</b> y</div>", Point{8, 0}, "dat", "<div> y</div>", Point{5, 0}},
+		{"<div><b>x</b> y</div>", Point{8, 0}, "d2it", "<div></div>", Point{5, 0}},
+		{"<p>a\n<br/>b</p>", Point{0, 1}, "dit", "<p></p>", Point{3, 0}},
+		{"foo bar baz", Point{5, 0}, "viwd", "foo  baz", Point{4, 0}},
+		{"a\nb\n\nc", Point{0, 0}, "vipd", "\nc", Point{0, 0}},
+		{"f(a)", Point{2, 0}, "va(d", "f", Point{0, 0}},
+	}
+	runKeysTests(t, tests, handleKeys, nil)
+}
+
+func TestTextObjectNotFound(t *testing.T) {
+	tests := []struct {
+		contents string
+		keys     string
+		mode     Mode
+	}{
+		{"no brackets", "di(", MODE_NORMAL},
+		{"no brackets", "ci(", MODE_NORMAL},
+		{"f(a", "ca(", MODE_NORMAL},
+		{"no quotes", "ci\"", MODE_NORMAL},
+		{"<b>no closing tag", "cit", MODE_NORMAL},
+		{"", "ciw", MODE_NORMAL},
+		{"no brackets", "vi(", MODE_VISUAL_RANGE},
+	}
+	for _, test := range tests {
+		var vim Vim
+		vim.init()
+		buffer := newTestBuffer(test.contents)
+		buffer.SetCursor(Point{1, 0})
+		keys := []rune(test.keys)
+		handleKeys(t, &vim, buffer, string(keys[:len(keys)-1]))
+		cursor := buffer.Cursor()
+		if err := vim.HandleKey(keys[len(keys)-1], buffer); err == nil {
+			t.Errorf("%q on %q succeeded", test.keys, test.contents)
+		}
+		if StringifyBuffer(buffer) != test.contents+"\n" || buffer.Cursor() != cursor || vim.mode != test.mode {
+			t.Errorf("%q on %q left %q cursor %v mode %v", test.keys, test.contents, StringifyBuffer(buffer), buffer.Cursor(), vim.mode)
+		}
+	}
+}
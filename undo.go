@@ -11,6 +11,8 @@ type Undoer interface {
 	StartChange()
 	// mark the end of a group of buffer changes started with StartChange
 	Commit() (err error)
+	// returns true if the buffer has changed since it was last saved
+	Modified() bool
 }
 
 // internal type which wraps a buffer with undo functionality
@@ -20,11 +22,15 @@ type undoBuffer struct {
 	changes     []changeGroup
 	nPending    int
 	pending     *changeGroup
+	// ids let us tell which group of changes the buffer was saved after, even
+	// when undo followed by new changes reuses its index
+	nextGroupId  int
+	savedGroupId int
 }
 
 // add undo to the provided buffer
 func NewUndoer(buffer Buffer) Undoer {
-	return &undoBuffer{buffer, -1, nil, 0, nil}
+	return &undoBuffer{buffer, -1, nil, 0, nil, 1, 0}
 }
 
 type changeType int
@@ -43,6 +49,7 @@ type change struct {
 }
 
 type changeGroup struct {
+	id          int
 	startCursor Point
 	changes     []change
 	endCursor   Point
@@ -79,7 +86,8 @@ func (buffer *undoBuffer) Undo() (err error) {
 	if buffer.changeIndex >= 0 {
 		buffer.changeIndex--
 	}
-	return nil
+	// put the cursor back where the change started
+	return buffer.SetCursor(ClampIn(buffer, undoGroup.startCursor))
 }
 
 func (buffer *undoBuffer) Redo() (err error) {
@@ -88,8 +96,9 @@ func (buffer *undoBuffer) Redo() (err error) {
 		return nil
 	}
 
+	// changes are replayed in the order they were made
 	redoGroup := &buffer.changes[buffer.changeIndex+1]
-	for i := len(redoGroup.changes) - 1; i >= 0; i-- {
+	for i := range redoGroup.changes {
 		toRedo := &redoGroup.changes[i]
 		switch toRedo.t {
 		default:
@@ -103,7 +112,7 @@ func (buffer *undoBuffer) Redo() (err error) {
 		}
 	}
 	buffer.changeIndex++
-	return nil
+	return buffer.SetCursor(ClampIn(buffer, redoGroup.startCursor))
 }
 
 func (buffer *undoBuffer) StartChange() {
@@ -112,7 +121,8 @@ func (buffer *undoBuffer) StartChange() {
 		return
 	}
 	// record cursor and add marker to indicate start of undo sequence
-	buffer.pending = &changeGroup{startCursor: buffer.Cursor()}
+	buffer.pending = &changeGroup{id: buffer.nextGroupId, startCursor: buffer.Cursor()}
+	buffer.nextGroupId++
 }
 
 func (buffer *undoBuffer) Commit() (err error) {
@@ -125,6 +135,12 @@ func (buffer *undoBuffer) Commit() (err error) {
 		return nil
 	}
 
+	if len(buffer.pending.changes) == 0 {
+		// nothing changed, so there is nothing to undo
+		buffer.pending = nil
+		return nil
+	}
+
 	buffer.pending.endCursor = buffer.Cursor()
 	if (buffer.changeIndex + 1) >= len(buffer.changes) {
 		buffer.changes = append(buffer.changes, *buffer.pending)
@@ -140,6 +156,25 @@ func (buffer *undoBuffer) Commit() (err error) {
 	return nil
 }
 
+// id of the last group of changes applied to the buffer, 0 if there is none
+func (buffer *undoBuffer) currentGroupId() int {
+	if buffer.changeIndex < 0 {
+		return 0
+	}
+	return buffer.changes[buffer.changeIndex].id
+}
+
+func (buffer *undoBuffer) Modified() bool {
+	return buffer.currentGroupId() != buffer.savedGroupId
+}
+
+func (buffer *undoBuffer) Save() (err error) {
+	if err = buffer.Buffer.Save(); err == nil {
+		buffer.savedGroupId = buffer.currentGroupId()
+	}
+	return
+}
+
 func (buffer *undoBuffer) InsertLine(lineIndex int, toInsert string) (err error) {
 	// TODO: bounds checking
 	if buffer.nPending != 0 {
@@ -1,10 +1,60 @@
 package main
 
+import (
+	"regexp"
+)
+
+// a view shows a buffer and owns the cursor and scroll used to look at it, so
+// several views can show different parts of the same buffer
 type View struct {
 	rect   Rect
 	scroll Point
 	buffer Buffer
 	cursor Point
+	// the text selected in visual mode, drawn in reverse video
+	selection Selection
+	// matches of the search being typed, nil when there isn't one
+	highlight *regexp.Regexp
+}
+
+// show buffer in the view. the view starts at the buffer's last cursor and its
+// cursor follows edits made to the buffer through other views
+func (view *View) SetBuffer(buffer Buffer) {
+	if view.buffer != nil {
+		view.buffer.Untrack(&view.cursor)
+	}
+
+	view.buffer = buffer
+	view.scroll = Point{}
+	if buffer != nil {
+		view.cursor = buffer.Cursor()
+		buffer.Track(&view.cursor)
+	}
+}
+
+// the view's cursor, kept on the buffer even if lines were deleted from under
+// it through another view
+func (view *View) Cursor() Point {
+	if view.buffer == nil || len(view.buffer.Lines()) == 0 {
+		return Point{}
+	}
+	return ClampOn(view.buffer, view.cursor)
+}
+
+// load the view's cursor into its buffer before working on the buffer through
+// this view
+func (view *View) Activate() {
+	view.cursor = view.Cursor()
+	if view.buffer != nil {
+		view.buffer.SetCursor(view.cursor)
+	}
+}
+
+// take back the cursor after working on the buffer through this view
+func (view *View) Deactivate() {
+	if view.buffer != nil {
+		view.cursor = view.buffer.Cursor()
+	}
 }
 
 func (view *View) ScrollTo(point Point) {
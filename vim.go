@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	//"log"
 	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // NOTE: idea for custom go motion: like j or k but combine them with an action, 3Md deletes 3 lines above and 3 lines below
@@ -11,7 +16,7 @@ type Mode int
 type ParseActionState int
 type ParseFunc func(*Action) ParseActionState
 type MotionFunc func(*Vim, *Action, Buffer) Range
-type VerbFunc func(*Vim, Buffer, Range) error
+type VerbFunc func(*Vim, *Action, Buffer, Range) error
 
 const (
 	MODE_NORMAL Mode = iota
@@ -22,6 +27,16 @@ const (
 	MODE_REPLACE
 )
 
+// keys with no character of their own, as the rune HandleKey takes for them
+const (
+	KEY_CTRL_C    rune = 0x03
+	KEY_CTRL_R    rune = 0x12
+	KEY_CTRL_V    rune = 0x16
+	KEY_ENTER     rune = '\r'
+	KEY_ESCAPE    rune = 0x1b
+	KEY_BACKSPACE rune = 0x7f
+)
+
 const (
 	PARSE_ACTION_STATE_INVALID ParseActionState = iota
 	PARSE_ACTION_STATE_KEY_NOT_HANDLED
@@ -33,36 +48,107 @@ const (
 type KeyBind struct {
 	function ParseFunc
 	key      rune
+	// the key which must be typed first, such as the g of ge. 0 for none
+	prefix rune
 }
 
 type Verb struct {
 	function VerbFunc
 	param    string
+	// perform the verb count times instead of moving the motion count times
+	repeat bool
 }
 
 type Motion struct {
-	function   MotionFunc
+	function MotionFunc
+	// the count typed after the verb, 0 when there wasn't one
 	multiplier int
 	param      string
 }
 
 type Action struct {
+	// the count typed before the verb, 0 when there wasn't one
 	multiplier int
 	motion     Motion
 	verb       Verb
 	final_mode Mode
-	yank       bool
+	// the mode the action was typed in
+	mode Mode
+	// the register named with ", 0 when none was
+	register rune
+	// a prefix key typed by the last key, which selects the bind for the next
+	prefix rune
+	// the key typed after a bind which consumes an additional key
+	key rune
 }
 
 type Vim struct {
 	mode    Mode
 	command []rune
 	binds   []KeyBind
+	// the undo group everything typed in insert mode is recorded in
+	insert_change Undoer
+	// the action which started the insert and the keys typed since
+	insert_action Action
+	inserted      []rune
+	// the text overwritten in replace mode, which backspace puts back. "" is
+	// text added past the end of a line and "\n" a line break typed
+	replaced  []string
+	registers Registers
+
+	// the last action which changed the buffer and the keys typed if it
+	// entered insert mode, which . performs again
+	last_change   *Action
+	last_inserted []rune
+	// set while . performs the last change, so it isn't recorded again
+	repeating bool
+
+	// the register keys are being recorded into, 0 when not recording, and
+	// the keys recorded so far
+	recording rune
+	macro     []rune
+	// the register last played with @, and how many macros are playing
+	last_macro  rune
+	macro_depth int
+
+	// the last f, F, t or T, which ; and , repeat
+	last_find Find
+	// the last search, which n and N repeat, and the prompt of the search
+	// being typed, 0 when there isn't one
+	last_search Search
+	searching   rune
+	// set by a motion which couldn't move, so the action isn't performed
+	motion_err error
+
+	// where the selection started in visual mode, and the lines a block
+	// insert is copied to when it stops
+	visual_start Point
+	block_insert *blockInsert
+	// the last selection made, whose lines the '< and '> marks are
+	last_selection Selection
+
+	settings        *EditSettings
+	search_settings *SearchSettings
 }
 
+// the text a motion moves over. the end is exclusive unless inclusive is set,
+// linewise ranges cover every line from start to end in full, and block ranges
+// cover the columns between start and end on each of those lines. once a block
+// is made exclusive its x are columns rather than bytes
 type Range struct {
-	start Point
-	end   Point
+	start     Point
+	end       Point
+	linewise  bool
+	inclusive bool
+	block     bool
+}
+
+// a search along the line for a character, made by f, F, t or T
+type Find struct {
+	char    rune
+	forward bool
+	// stop just before the character rather than on it
+	till bool
 }
 
 type Span struct {
@@ -70,30 +156,228 @@ type Span struct {
 	end   int
 }
 
+func (mode Mode) String() string {
+	switch mode {
+	case MODE_NORMAL:
+		return "NORMAL"
+	case MODE_INSERT:
+		return "INSERT"
+	case MODE_VISUAL_RANGE:
+		return "VISUAL"
+	case MODE_VISUAL_LINE:
+		return "V-LINE"
+	case MODE_VISUAL_BLOCK:
+		return "V-BLOCK"
+	case MODE_REPLACE:
+		return "REPLACE"
+	}
+	return "UNKNOWN"
+}
+
 func (vim *Vim) init() {
 	vim.binds = append(vim.binds, KeyBind{key: 'h', function: parseMotionLeft})
 	vim.binds = append(vim.binds, KeyBind{key: 'l', function: parseMotionRight})
 	vim.binds = append(vim.binds, KeyBind{key: 'j', function: parseMotionDown})
 	vim.binds = append(vim.binds, KeyBind{key: 'k', function: parseMotionUp})
+	vim.binds = append(vim.binds, KeyBind{key: '0', function: parseMotionLineStart})
+	vim.binds = append(vim.binds, KeyBind{key: 'w', function: parseMotionWordForward})
+	vim.binds = append(vim.binds, KeyBind{key: 'W', function: parseMotionBigWordForward})
+	vim.binds = append(vim.binds, KeyBind{key: 'b', function: parseMotionWordBackward})
+	vim.binds = append(vim.binds, KeyBind{key: 'B', function: parseMotionBigWordBackward})
+	vim.binds = append(vim.binds, KeyBind{key: 'e', function: parseMotionWordEnd})
+	vim.binds = append(vim.binds, KeyBind{key: 'E', function: parseMotionBigWordEnd})
+	vim.binds = append(vim.binds, KeyBind{key: 'g', function: parsePrefixG})
+	vim.binds = append(vim.binds, KeyBind{key: 'e', prefix: 'g', function: parseMotionWordEndBackward})
+	vim.binds = append(vim.binds, KeyBind{key: 'E', prefix: 'g', function: parseMotionBigWordEndBackward})
+	vim.binds = append(vim.binds, KeyBind{key: '$', function: parseMotionLineEndChar})
+	vim.binds = append(vim.binds, KeyBind{key: 'f', function: parseFindForward})
+	vim.binds = append(vim.binds, KeyBind{key: 'F', function: parseFindBackward})
+	vim.binds = append(vim.binds, KeyBind{key: 't', function: parseTillForward})
+	vim.binds = append(vim.binds, KeyBind{key: 'T', function: parseTillBackward})
+	vim.binds = append(vim.binds, KeyBind{key: ';', function: parseFindNext})
+	vim.binds = append(vim.binds, KeyBind{key: ',', function: parseFindPrevious})
+	vim.binds = append(vim.binds, KeyBind{key: 'G', function: parseMotionLastLine})
+	vim.binds = append(vim.binds, KeyBind{key: 'g', prefix: 'g', function: parseMotionFirstLine})
+	vim.binds = append(vim.binds, KeyBind{key: '"', function: parseRegister})
 	vim.binds = append(vim.binds, KeyBind{key: 'd', function: parseVerbDelete})
+	vim.binds = append(vim.binds, KeyBind{key: 'y', function: parseVerbYank})
+	vim.binds = append(vim.binds, KeyBind{key: 'Y', function: parseYankLine})
+	vim.binds = append(vim.binds, KeyBind{key: 'p', function: parsePutAfter})
+	vim.binds = append(vim.binds, KeyBind{key: 'P', function: parsePutBefore})
+	vim.binds = append(vim.binds, KeyBind{key: 'J', function: parseJoin})
+	vim.binds = append(vim.binds, KeyBind{key: 'r', function: parseReplaceChar})
+	vim.binds = append(vim.binds, KeyBind{key: 'R', function: parseReplaceMode})
+	vim.binds = append(vim.binds, KeyBind{key: '.', function: parseRepeat})
+	vim.binds = append(vim.binds, KeyBind{key: 'q', function: parseRecord})
+	vim.binds = append(vim.binds, KeyBind{key: '@', function: parsePlay})
+	vim.binds = append(vim.binds, KeyBind{key: 'u', function: parseUndo})
+	vim.binds = append(vim.binds, KeyBind{key: KEY_CTRL_R, function: parseRedo})
+	vim.binds = append(vim.binds, KeyBind{key: 'i', function: parseInsert})
+	vim.binds = append(vim.binds, KeyBind{key: 'a', function: parseAppend})
+	vim.binds = append(vim.binds, KeyBind{key: 'I', function: parseInsertLineStart})
+	vim.binds = append(vim.binds, KeyBind{key: 'A', function: parseAppendLineEnd})
+	vim.binds = append(vim.binds, KeyBind{key: 'o', function: parseOpenLineBelow})
+	vim.binds = append(vim.binds, KeyBind{key: 'O', function: parseOpenLineAbove})
+	vim.binds = append(vim.binds, KeyBind{key: 'v', function: parseVisualRange})
+	vim.binds = append(vim.binds, KeyBind{key: 'V', function: parseVisualLine})
+	vim.binds = append(vim.binds, KeyBind{key: KEY_CTRL_V, function: parseVisualBlock})
+	vim.binds = append(vim.binds, KeyBind{key: 'c', function: parseVerbChange})
+	vim.binds = append(vim.binds, KeyBind{key: 'C', function: parseChangeLineEnd})
+	vim.binds = append(vim.binds, KeyBind{key: 's', function: parseSubstitute})
+	vim.binds = append(vim.binds, KeyBind{key: 'S', function: parseSubstituteLine})
+	vim.binds = append(vim.binds, KeyBind{key: '>', function: parseShiftRight})
+	vim.binds = append(vim.binds, KeyBind{key: '<', function: parseShiftLeft})
+	vim.binds = append(vim.binds, KeyBind{key: '~', function: parseToggleCase})
+	vim.binds = append(vim.binds, KeyBind{key: 'U', function: parseUpperCase})
+	for _, prefix := range []rune{'i', 'a'} {
+		vim.binds = append(vim.binds, KeyBind{key: 'w', prefix: prefix, function: parseObjectWord})
+		vim.binds = append(vim.binds, KeyBind{key: 'W', prefix: prefix, function: parseObjectBigWord})
+		vim.binds = append(vim.binds, KeyBind{key: '"', prefix: prefix, function: parseObjectDoubleQuote})
+		vim.binds = append(vim.binds, KeyBind{key: '\'', prefix: prefix, function: parseObjectSingleQuote})
+		vim.binds = append(vim.binds, KeyBind{key: '`', prefix: prefix, function: parseObjectBackQuote})
+		vim.binds = append(vim.binds, KeyBind{key: '(', prefix: prefix, function: parseObjectParens})
+		vim.binds = append(vim.binds, KeyBind{key: ')', prefix: prefix, function: parseObjectParens})
+		vim.binds = append(vim.binds, KeyBind{key: 'b', prefix: prefix, function: parseObjectParens})
+		vim.binds = append(vim.binds, KeyBind{key: '{', prefix: prefix, function: parseObjectBraces})
+		vim.binds = append(vim.binds, KeyBind{key: '}', prefix: prefix, function: parseObjectBraces})
+		vim.binds = append(vim.binds, KeyBind{key: 'B', prefix: prefix, function: parseObjectBraces})
+		vim.binds = append(vim.binds, KeyBind{key: '[', prefix: prefix, function: parseObjectBrackets})
+		vim.binds = append(vim.binds, KeyBind{key: ']', prefix: prefix, function: parseObjectBrackets})
+		vim.binds = append(vim.binds, KeyBind{key: '<', prefix: prefix, function: parseObjectAngleBrackets})
+		vim.binds = append(vim.binds, KeyBind{key: '>', prefix: prefix, function: parseObjectAngleBrackets})
+		vim.binds = append(vim.binds, KeyBind{key: 'p', prefix: prefix, function: parseObjectParagraph})
+		vim.binds = append(vim.binds, KeyBind{key: 't', prefix: prefix, function: parseObjectTag})
+	}
+
+	vim.binds = append(vim.binds, KeyBind{key: '/', function: parseSearchForward})
+	vim.binds = append(vim.binds, KeyBind{key: '?', function: parseSearchBackward})
+	vim.binds = append(vim.binds, KeyBind{key: 'n', function: parseSearchNext})
+	vim.binds = append(vim.binds, KeyBind{key: 'N', function: parseSearchPrevious})
+	vim.binds = append(vim.binds, KeyBind{key: '*', function: parseSearchWordForward})
+	vim.binds = append(vim.binds, KeyBind{key: '#', function: parseSearchWordBackward})
+
+	if vim.settings == nil {
+		vim.settings = &EditSettings{shiftWidth: 4}
+	}
+	if vim.search_settings == nil {
+		vim.search_settings = &SearchSettings{}
+	}
+}
+
+// handle a key typed in any mode, recording it if a macro is being recorded.
+// keys played by a macro aren't recorded, as the @ which played it already
+// was. returns any error performing an action
+func (vim *Vim) HandleKey(key rune, buffer Buffer) (err error) {
+	if key == 0 {
+		return
+	}
+	if vim.recording != 0 && vim.macro_depth == 0 {
+		if vim.mode == MODE_NORMAL && key == 'q' && len(vim.command) == 0 {
+			vim.stopRecording()
+			return
+		}
+		vim.macro = append(vim.macro, key)
+	}
+
+	if isInserting(vim.mode) {
+		switch key {
+		case KEY_ESCAPE:
+			return vim.StopInsert(buffer)
+		case KEY_ENTER, '\n':
+			return vim.InsertNewline(buffer)
+		case KEY_BACKSPACE, '\b':
+			return vim.InsertBackspace(buffer)
+		}
+		return vim.InsertText(buffer, string(key))
+	}
+
+	if key == KEY_ESCAPE {
+		// abandon a partially typed command, or the selection if there isn't one
+		if len(vim.command) == 0 && isVisual(vim.mode) {
+			vim.StopVisual(buffer)
+		}
+		vim.command = []rune{}
+		vim.searching = 0
+		return
+	}
+
+	state, action := vim.ParseAction(key)
+	if state == PARSE_ACTION_STATE_COMPLETE {
+		err = vim.Perform(&action, buffer)
+	}
+	return
+}
+
+// end whatever the keys typed so far left unfinished, like an insert, a
+// selection or a partly typed command, as if escape was typed
+func (vim *Vim) Abandon(buffer Buffer) error {
+	for isInserting(vim.mode) || isVisual(vim.mode) || len(vim.command) > 0 {
+		if err := vim.HandleKey(KEY_ESCAPE, buffer); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (vim *Vim) ParseAction(key rune) (state ParseActionState, action Action) {
-	action.multiplier = 1
-	action.motion.multiplier = 1
 	vim.command = append(vim.command, key)
 
+	// actions typed in visual mode stay in it unless they say otherwise
+	action.mode = vim.mode
+	if isVisual(vim.mode) {
+		action.final_mode = vim.mode
+	}
+
 	// parse the commands
+	vim.searching = 0
+	count := 0
+	var consume ParseFunc
 	for _, command_key := range vim.command {
+		// hand the key to the bind waiting for it, which may wait for more
+		if consume != nil {
+			action.key = command_key
+			state = consume(&action)
+			if state != PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY {
+				consume = nil
+			}
+			if state == PARSE_ACTION_STATE_COMPLETE || state == PARSE_ACTION_STATE_INVALID {
+				vim.command = []rune{}
+				return state, action
+			}
+			continue
+		}
+
+		// digits are a count, except for a leading 0 which moves to the start of the line
+		if (command_key >= '1' && command_key <= '9') || (command_key == '0' && count > 0) {
+			count = count*10 + int(command_key-'0')
+			state = PARSE_ACTION_STATE_IN_PROGRESS
+			continue
+		}
+
+		// a count before the verb multiplies the action, after it the motion
+		if count > 0 {
+			if action.verb.function == nil {
+				action.multiplier = count
+			} else {
+				action.motion.multiplier = count
+			}
+			count = 0
+		}
+
 		state = PARSE_ACTION_STATE_INVALID
+		prefix := action.prefix
+		action.prefix = 0
 
 		for _, bind := range vim.binds {
-			if bind.key == command_key {
+			if bind.key == command_key && bind.prefix == prefix {
+				action.key = 0
 				state = bind.function(&action)
 
 				switch state {
 				default:
 				case PARSE_ACTION_STATE_INVALID:
+				case PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY:
+					consume = bind.function
 				case PARSE_ACTION_STATE_COMPLETE:
 					vim.command = []rune{}
 					return state, action
@@ -109,12 +393,87 @@ func (vim *Vim) ParseAction(key rune) (state ParseActionState, action Action) {
 		}
 	}
 
+	if state == PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY {
+		vim.searching = searchPrompt(&action)
+	}
 	return state, action
 }
 
+// returns true when a count was typed for the action
+func (action *Action) HasCount() bool {
+	return action.multiplier > 0 || action.motion.multiplier > 0
+}
+
+// the number of times to perform the action. counts typed before the verb and
+// before the motion multiply, so 2d3w deletes six words
+func (action *Action) Count() int {
+	count := 1
+	if action.multiplier > 0 {
+		count *= action.multiplier
+	}
+	if action.motion.multiplier > 0 {
+		count *= action.motion.multiplier
+	}
+	return count
+}
+
 func (vim *Vim) Perform(action *Action, buffer Buffer) (err error) {
-	r := action.motion.function(vim, action, buffer)
-	return action.verb.function(vim, buffer, r)
+	if isVisual(vim.mode) {
+		vim.markSelection(buffer)
+	}
+
+	// a motion which fails, like a search finding nothing, stops the action
+	var r Range
+	if !action.verb.repeat {
+		r = action.motion.function(vim, action, buffer)
+		if err = vim.motionError(); err != nil {
+			return
+		}
+	}
+
+	if isInserting(action.final_mode) {
+		// anything the action changes is part of the insert for undo
+		vim.startInsert(action, buffer)
+	}
+
+	// everything one action changes is undone together
+	if undoer, ok := buffer.(Undoer); ok {
+		undoer.StartChange()
+		defer undoer.Commit()
+	}
+
+	// changes made to a selection aren't repeated, as the selection is gone
+	if isChange(action) && !vim.repeating && !isVisual(action.mode) {
+		change := *action
+		vim.last_change = &change
+		vim.last_inserted = nil
+	}
+
+	vim.mode = action.final_mode
+	if !action.verb.repeat {
+		return action.verb.function(vim, action, buffer, r)
+	}
+
+	// the motion moves once for each time the verb is performed
+	once := *action
+	once.multiplier = 0
+	once.motion.multiplier = 0
+	for i := 0; i < action.Count(); i++ {
+		r = once.motion.function(vim, &once, buffer)
+		if err = vim.motionError(); err != nil {
+			return
+		}
+		if err = once.verb.function(vim, &once, buffer, r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// returns and clears the error set by the last motion
+func (vim *Vim) motionError() (err error) {
+	err, vim.motion_err = vim.motion_err, nil
+	return
 }
 
 func (r *Range) Sort() {
@@ -158,68 +517,745 @@ func parseMotionDown(action *Action) ParseActionState {
 	return PARSE_ACTION_STATE_COMPLETE
 }
 
+func parseMotionLineStart(action *Action) ParseActionState {
+	action.motion.function = motionLineStart
+	if action.verb.function == nil {
+		action.verb.function = verbMotion
+	}
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+func parseMotionWordForward(action *Action) ParseActionState {
+	return parseMotion(action, motionWordForward)
+}
+
+func parseMotionBigWordForward(action *Action) ParseActionState {
+	return parseMotion(action, motionBigWordForward)
+}
+
+func parseMotionWordBackward(action *Action) ParseActionState {
+	return parseMotion(action, motionWordBackward)
+}
+
+func parseMotionBigWordBackward(action *Action) ParseActionState {
+	return parseMotion(action, motionBigWordBackward)
+}
+
+func parseMotionWordEnd(action *Action) ParseActionState {
+	return parseMotion(action, motionWordEnd)
+}
+
+func parseMotionBigWordEnd(action *Action) ParseActionState {
+	return parseMotion(action, motionBigWordEnd)
+}
+
+func parseMotionWordEndBackward(action *Action) ParseActionState {
+	return parseMotion(action, motionWordEndBackward)
+}
+
+func parseMotionBigWordEndBackward(action *Action) ParseActionState {
+	return parseMotion(action, motionBigWordEndBackward)
+}
+
+func parseMotion(action *Action, motion MotionFunc) ParseActionState {
+	action.motion.function = motion
+	if action.verb.function == nil {
+		action.verb.function = verbMotion
+	}
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// g selects a different bind for the key after it
+func parsePrefixG(action *Action) ParseActionState {
+	action.prefix = 'g'
+	return PARSE_ACTION_STATE_IN_PROGRESS
+}
+
+func parseMotionLineEndChar(action *Action) ParseActionState {
+	return parseMotion(action, motionLineEndChar)
+}
+
+func parseFindForward(action *Action) ParseActionState {
+	return parseFind(action, motionFindForward)
+}
+
+func parseFindBackward(action *Action) ParseActionState {
+	return parseFind(action, motionFindBackward)
+}
+
+func parseTillForward(action *Action) ParseActionState {
+	return parseFind(action, motionTillForward)
+}
+
+func parseTillBackward(action *Action) ParseActionState {
+	return parseFind(action, motionTillBackward)
+}
+
+// the character to find is the key typed next, which goes in the motion's
+// parameter
+func parseFind(action *Action, motion MotionFunc) ParseActionState {
+	if action.key == 0 {
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+	if unicode.IsControl(action.key) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.param = string(action.key)
+	return parseMotion(action, motion)
+}
+
+// ; repeats the last find
+func parseFindNext(action *Action) ParseActionState {
+	return parseMotion(action, motionFindNext)
+}
+
+// , repeats the last find in the other direction
+func parseFindPrevious(action *Action) ParseActionState {
+	return parseMotion(action, motionFindPrevious)
+}
+
+func parseMotionLastLine(action *Action) ParseActionState {
+	return parseMotion(action, motionLastLine)
+}
+
+func parseMotionFirstLine(action *Action) ParseActionState {
+	return parseMotion(action, motionFirstLine)
+}
+
+func parseJoin(action *Action) ParseActionState {
+	if isVisual(action.mode) {
+		state := parseSelection(action, verbJoin)
+		action.motion.function = motionJoinSelection
+		return state
+	}
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionJoinLines
+	action.verb.function = verbJoin
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// replace the character under the cursor, and those after it for a count,
+// with the key typed after r. enter replaces them with a single line break
+func parseReplaceChar(action *Action) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if action.key == 0 {
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+	action.verb.param = string(action.key)
+	if action.key == KEY_ENTER || action.key == '\n' {
+		action.verb.param = "\n"
+	} else if unicode.IsControl(action.key) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionCharacters
+	action.verb.function = verbReplaceChar
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// overwrite the text at the cursor with what is typed until escape
+func parseReplaceMode(action *Action) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verbMotion
+	action.final_mode = MODE_REPLACE
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// perform the last change again
+func parseRepeat(action *Action) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verbRepeat
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// undo, or lower case the selection in visual mode
+func parseUndo(action *Action) ParseActionState {
+	if isVisual(action.mode) {
+		return parseSelection(action, verbLowerCase)
+	}
+	return parseHistory(action, verbUndo)
+}
+
+func parseRedo(action *Action) ParseActionState {
+	return parseHistory(action, verbRedo)
+}
+
+func parseHistory(action *Action, verb VerbFunc) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verb
+	action.verb.repeat = true
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// name the register the action yanks into or puts from
+func parseRegister(action *Action) ParseActionState {
+	if action.verb.function != nil || action.register != 0 {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if action.key == 0 {
+		return PARSE_ACTION_STATE_CONSUME_ADDITIONAL_KEY
+	}
+	if !validRegister(action.key) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.register = action.key
+	action.key = 0
+	return PARSE_ACTION_STATE_IN_PROGRESS
+}
+
 func parseVerbDelete(action *Action) ParseActionState {
+	return parseOperator(action, verbDelete)
+}
+
+func parseVerbYank(action *Action) ParseActionState {
+	return parseOperator(action, verbYank)
+}
+
+// delete the text a motion moves over, or the selection, and start inserting
+// in its place
+func parseVerbChange(action *Action) ParseActionState {
+	state := parseOperator(action, verbChange)
+	action.final_mode = MODE_INSERT
+	return state
+}
+
+// C changes to the end of the line like c$, and the selected lines in visual
+// mode
+func parseChangeLineEnd(action *Action) ParseActionState {
+	return parseChangeWith(action, motionLineEndChar)
+}
+
+// s changes the character under the cursor and those after it, one for each
+// count. in visual mode it changes the selection like c
+func parseSubstitute(action *Action) ParseActionState {
+	if isVisual(action.mode) {
+		return parseVerbChange(action)
+	}
+	return parseChangeWith(action, motionLineCharacters)
+}
+
+// S changes whole lines like cc
+func parseSubstituteLine(action *Action) ParseActionState {
+	return parseChangeWith(action, motionCurrentLine)
+}
+
+func parseChangeWith(action *Action, motion MotionFunc) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if isVisual(action.mode) {
+		motion = motionSelectedLines
+	}
+	action.motion.function = motion
+	action.verb.function = verbChange
+	action.final_mode = MODE_INSERT
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+func parseShiftRight(action *Action) ParseActionState {
+	return parseOperator(action, verbShiftRight)
+}
+
+func parseShiftLeft(action *Action) ParseActionState {
+	return parseOperator(action, verbShiftLeft)
+}
+
+// toggle the case of the character under the cursor and those after it, one
+// for each count, or of the selection in visual mode
+func parseToggleCase(action *Action) ParseActionState {
+	if isVisual(action.mode) {
+		return parseSelection(action, verbToggleCase)
+	}
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionLineCharacters
+	action.verb.function = verbToggleCase
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// upper case the selection in visual mode
+func parseUpperCase(action *Action) ParseActionState {
+	if !isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	return parseSelection(action, verbUpperCase)
+}
+
+// an operator waits for a motion, or works on whole lines when doubled as in
+// dd. in visual mode it works on the selection straight away
+func parseOperator(action *Action, verb VerbFunc) ParseActionState {
+	if isVisual(action.mode) {
+		return parseSelection(action, verb)
+	}
 	if action.verb.function == nil {
-		action.verb.function = verbDelete
+		action.verb.function = verb
 		return PARSE_ACTION_STATE_IN_PROGRESS
-	} else {
-		action.motion.function = motionCurrentLine
+	}
+	if !isVerb(action, verb) {
+		return PARSE_ACTION_STATE_INVALID
 	}
 
+	action.motion.function = motionCurrentLine
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// Y yanks whole lines like yy
+func parseYankLine(action *Action) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionCurrentLine
+	action.verb.function = verbYank
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+func parsePutAfter(action *Action) ParseActionState {
+	return parsePut(action, verbPutAfter)
+}
+
+func parsePutBefore(action *Action) ParseActionState {
+	return parsePut(action, verbPutBefore)
+}
+
+func parsePut(action *Action, verb VerbFunc) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verb
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// enter insert mode at the cursor. after an operator, or in visual mode, i
+// starts an inner text object
+func parseInsert(action *Action) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return parsePrefixTextObject(action, 'i')
+	}
+	return parseInsertAt(action, motionNone)
+}
+
+// enter insert mode after the cursor. after an operator, or in visual mode, a
+// starts a text object including what surrounds it
+func parseAppend(action *Action) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return parsePrefixTextObject(action, 'a')
+	}
+	return parseInsertAt(action, motionAppend)
+}
+
+// enter insert mode before the first non blank character of the line, or
+// before a block on each of its lines
+func parseInsertLineStart(action *Action) ParseActionState {
+	if action.mode == MODE_VISUAL_BLOCK {
+		return parseBlockInsert(action, verbBlockInsert)
+	}
+	return parseInsertAt(action, motionLineFirstNonBlank)
+}
+
+// enter insert mode at the end of the line, or after a block on each of its
+// lines
+func parseAppendLineEnd(action *Action) ParseActionState {
+	if action.mode == MODE_VISUAL_BLOCK {
+		return parseBlockInsert(action, verbBlockAppend)
+	}
+	return parseInsertAt(action, motionLineEnd)
+}
+
+func parseInsertAt(action *Action, motion MotionFunc) ParseActionState {
+	if action.verb.function != nil || isVisual(action.mode) {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motion
+	action.verb.function = verbMotion
+	action.final_mode = MODE_INSERT
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// open a new line below the cursor and enter insert mode on it
+func parseOpenLineBelow(action *Action) ParseActionState {
+	return parseOpenLine(action, verbOpenLineBelow)
+}
+
+// open a new line above the cursor and enter insert mode on it
+func parseOpenLineAbove(action *Action) ParseActionState {
+	return parseOpenLine(action, verbOpenLineAbove)
+}
+
+// in visual mode, o and O move the cursor to the other end of the selection
+func parseOpenLine(action *Action, verb VerbFunc) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	if isVisual(action.mode) {
+		action.motion.function = motionNone
+		action.verb.function = verbSwapSelection
+		return PARSE_ACTION_STATE_COMPLETE
+	}
+	action.motion.function = motionNone
+	action.verb.function = verb
+	action.final_mode = MODE_INSERT
 	return PARSE_ACTION_STATE_COMPLETE
 }
 
 // motion functions
+func motionNone(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = r.start
+	return r
+}
+
+// move one past the cursor, which may be just after the end of the line
+func motionAppend(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = ClampOn(buffer, Point{r.start.x + 1, r.start.y})
+	return r
+}
+
+func motionLineFirstNonBlank(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = Point{firstNonBlank(buffer.Lines()[r.start.y]), r.start.y}
+	return r
+}
+
+// move just after the end of the line
+func motionLineEnd(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = Point{len(buffer.Lines()[r.start.y]), r.start.y}
+	return r
+}
+
+// move left count characters, stopping at the start of the line
 func motionLeft(vim *Vim, action *Action, buffer Buffer) (r Range) {
 	r.start = buffer.Cursor()
-	r.end = MoveCursor(buffer, r.start, Point{-1, 0})
+	r.end = ClampOn(buffer, r.start)
+	for i := 0; i < action.Count() && r.end.x > 0; i++ {
+		r.end, _ = prevPoint(buffer, r.end)
+	}
 	return r
 }
 
+// move right count characters, stopping after the end of the line
 func motionRight(vim *Vim, action *Action, buffer Buffer) (r Range) {
 	r.start = buffer.Cursor()
-	r.end = MoveCursor(buffer, r.start, Point{1, 0})
+	r.end = ClampOn(buffer, r.start)
+	for i := 0; i < action.Count() && r.end.x < len(buffer.Lines()[r.end.y]); i++ {
+		r.end, _ = nextPoint(buffer, r.end)
+	}
 	return r
 }
 
+// move up count lines, stopping at the first line. the motion fails if the
+// cursor is already there, so operators don't act on the line alone
 func motionUp(vim *Vim, action *Action, buffer Buffer) (r Range) {
 	r.start = buffer.Cursor()
-	aF := reflect.ValueOf(verbMotion)
-	bF := reflect.ValueOf(action.verb.function)
-	if aF.Pointer() == bF.Pointer() {
-		r.end = MoveCursor(buffer, r.start, Point{0, -1})
-	} else {
-		r.start.x = stringLastIndex(buffer.Lines()[r.start.y])
-		r.end.y = r.start.y - 1
-		r.end.x = 0
+	r.end = MoveCursor(buffer, r.start, Point{0, -action.Count()})
+	r.linewise = true
+	if r.end.y == r.start.y {
+		vim.motion_err = errors.New("already on the first line")
 	}
 	return r
 }
 
+// move down count lines, stopping at the last line. like motionUp it fails
+// if the cursor can't move
 func motionDown(vim *Vim, action *Action, buffer Buffer) (r Range) {
 	r.start = buffer.Cursor()
-	aF := reflect.ValueOf(verbMotion)
-	bF := reflect.ValueOf(action.verb.function)
-	if aF.Pointer() == bF.Pointer() {
-		r.end = MoveCursor(buffer, r.start, Point{0, 1})
-	} else {
-		r.start.x = 0
-		r.end.y = r.start.y + 1
-		r.end.x = stringLastIndex(buffer.Lines()[r.end.y])
+	r.end = MoveCursor(buffer, r.start, Point{0, action.Count()})
+	r.linewise = true
+	if r.end.y == r.start.y {
+		vim.motion_err = errors.New("already on the last line")
 	}
 	return r
 }
 
+func motionLineStart(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = Point{0, r.start.y}
+	return r
+}
+
+// the current line and the lines below it, one line for each count
 func motionCurrentLine(vim *Vim, action *Action, buffer Buffer) (r Range) {
 	line := buffer.Cursor().y
 	r.start = Point{0, line}
-	r.end = Point{stringLastIndex(buffer.Lines()[line]), line}
+	r.end = Point{0, Clamp(line+action.Count()-1, line, len(buffer.Lines())-1)}
+	r.linewise = true
+	return r
+}
+
+// move to the last character of the line, or of the line count-1 lines down.
+// the range ends after it so operators include it
+func motionLineEndChar(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	y := Clamp(r.start.y+action.Count()-1, 0, len(buffer.Lines())-1)
+	r.end = Point{len(buffer.Lines()[y]), y}
+	return r
+}
+
+func motionFindForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionFind(vim, action, buffer, Find{paramRune(action), true, false}, false)
+}
+
+func motionFindBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionFind(vim, action, buffer, Find{paramRune(action), false, false}, false)
+}
+
+func motionTillForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionFind(vim, action, buffer, Find{paramRune(action), true, true}, false)
+}
+
+func motionTillBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionFind(vim, action, buffer, Find{paramRune(action), false, true}, false)
+}
+
+func motionFindNext(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionFind(vim, action, buffer, vim.last_find, true)
+}
+
+func motionFindPrevious(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	find := vim.last_find
+	find.forward = !find.forward
+	return motionFind(vim, action, buffer, find, true)
+}
+
+// move to the count'th occurrence of a character along the line, remembering
+// the find for ; and , unless it is one of them. searching forward includes
+// the character the motion stops on. if there aren't count of them the range
+// is empty and the error stops the action
+func motionFind(vim *Vim, action *Action, buffer Buffer, find Find, again bool) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = r.start
+	if !again {
+		vim.last_find = find
+	}
+	if find.char == 0 {
+		vim.motion_err = errors.New("no previous find")
+		return r
+	}
+	not_found := func() Range {
+		vim.motion_err = errors.New(fmt.Sprintf("character not found: %c", find.char))
+		return r
+	}
+
+	line := buffer.Lines()[r.start.y]
+	x := r.start.x
+	step := func() bool {
+		if find.forward {
+			if x >= len(line) {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(line[x:])
+			x += size
+			return x < len(line)
+		}
+		if x <= 0 {
+			return false
+		}
+		_, size := utf8.DecodeLastRuneInString(line[:x])
+		x -= size
+		return true
+	}
+
+	// repeating t or T doesn't find the character it stopped next to again
+	if find.till && again && !step() {
+		return not_found()
+	}
+	for count := action.Count(); count > 0; {
+		if !step() {
+			return not_found()
+		}
+		if ch, _ := utf8.DecodeRuneInString(line[x:]); ch == find.char {
+			count--
+		}
+	}
+
+	r.end = Point{x, r.start.y}
+	r.inclusive = find.forward
+	if find.till {
+		find.forward = !find.forward
+		step()
+		r.end.x = x
+	}
+	return r
+}
+
+// the first character of the motion's parameter
+func paramRune(action *Action) rune {
+	ch, _ := utf8.DecodeRuneInString(action.motion.param)
+	return ch
+}
+
+// move to the line given by the count, or the last line
+func motionLastLine(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	y := len(buffer.Lines()) - 1
+	if action.HasCount() {
+		y = action.Count() - 1
+	}
+	return motionToLine(buffer, y)
+}
+
+// move to the line given by the count, or the first line
+func motionFirstLine(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionToLine(buffer, action.Count()-1)
+}
+
+func motionToLine(buffer Buffer, y int) (r Range) {
+	r.start = buffer.Cursor()
+	y = Clamp(y, 0, len(buffer.Lines())-1)
+	r.end = Point{firstNonBlank(buffer.Lines()[y]), y}
+	r.linewise = true
+	return r
+}
+
+// the lines joined by J, which joins at least two lines
+func motionJoinLines(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	lines := action.Count()
+	if lines < 2 {
+		lines = 2
+	}
+	r.end = Point{0, Clamp(r.start.y+lines-1, r.start.y, len(buffer.Lines())-1)}
+	r.linewise = true
+	return r
+}
+
+// the character under the cursor and those after it, one for each count. the
+// range is empty if the line is too short
+func motionCharacters(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = r.start
+	line := buffer.Lines()[r.start.y]
+	for i := 0; i < action.Count(); i++ {
+		if r.end.x >= len(line) {
+			r.end = r.start
+			break
+		}
+		r.end, _ = nextPoint(buffer, r.end)
+	}
+	return r
+}
+
+// the character under the cursor and those after it, one for each count, up to
+// the end of the line
+func motionLineCharacters(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = buffer.Cursor()
+	r.end = r.start
+	for i := 0; i < action.Count() && r.end.x < len(buffer.Lines()[r.end.y]); i++ {
+		r.end, _ = nextPoint(buffer, r.end)
+	}
+	return r
+}
+
+func motionWordForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionWordStart(action, buffer, false)
+}
+
+func motionBigWordForward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return motionWordStart(action, buffer, true)
+}
+
+// move to the start of the count'th next word. when deleting, the last word
+// at the end of a line stops at the end of that line rather than taking the
+// line break with it. cw on a word changes to the end of it like ce
+func motionWordStart(action *Action, buffer Buffer, bigword bool) (r Range) {
+	if isVerb(action, verbChange) {
+		if class := charClass(buffer, buffer.Cursor(), bigword); class != CHAR_CLASS_BLANK && class != CHAR_CLASS_EMPTY_LINE {
+			return changeWords(action, buffer, bigword)
+		}
+	}
+
+	r = moveWords(action, buffer, nextWordStart, bigword)
+	if isMotionOnly(action) || r.end.y == r.start.y {
+		return r
+	}
+
+	last, ok := prevPoint(buffer, r.end)
+	for ok && last.IsAfter(r.start) {
+		if class := charClass(buffer, last, bigword); class != CHAR_CLASS_BLANK && class != CHAR_CLASS_EMPTY_LINE {
+			break
+		}
+		last, ok = prevPoint(buffer, last)
+	}
+	if last.IsAfter(r.start) && last.y < r.end.y {
+		r.end, _ = nextPoint(buffer, last)
+	}
+	return r
+}
+
+// the words changed by cw, which leaves the white space after the last one
+func changeWords(action *Action, buffer Buffer, bigword bool) (r Range) {
+	r.start = ClampOn(buffer, buffer.Cursor())
+	r.end = r.start
+	for i := 0; i < action.Count(); i++ {
+		next, ok := nextPoint(buffer, r.end)
+		at_end := !ok || next.y != r.end.y || charClass(buffer, next, bigword) != charClass(buffer, r.end, bigword)
+		if i > 0 || !at_end {
+			r.end = nextWordEnd(buffer, r.end, bigword)
+		}
+	}
+	r.inclusive = true
+	return r
+}
+
+func motionWordBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return moveWords(action, buffer, prevWordStart, false)
+}
+
+func motionBigWordBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	return moveWords(action, buffer, prevWordStart, true)
+}
+
+func motionWordEnd(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = moveWords(action, buffer, nextWordEnd, false)
+	r.inclusive = true
+	return r
+}
+
+func motionBigWordEnd(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = moveWords(action, buffer, nextWordEnd, true)
+	r.inclusive = true
+	return r
+}
+
+func motionWordEndBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = moveWords(action, buffer, prevWordEnd, false)
+	r.inclusive = true
+	return r
+}
+
+func motionBigWordEndBackward(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = moveWords(action, buffer, prevWordEnd, true)
+	r.inclusive = true
+	return r
+}
+
+// apply a word step once for each count
+func moveWords(action *Action, buffer Buffer, step func(Buffer, Point, bool) Point, bigword bool) (r Range) {
+	r.start = ClampOn(buffer, buffer.Cursor())
+	r.end = r.start
+	for i := 0; i < action.Count(); i++ {
+		r.end = step(buffer, r.end, bigword)
+	}
 	return r
 }
 
 // verb functions
-func verbMotion(vim *Vim, buffer Buffer, r Range) (err error) {
-	if vim.mode != MODE_INSERT {
+func verbMotion(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if !isInserting(vim.mode) {
 		r.end = ClampIn(buffer, r.end)
 	}
 
@@ -227,68 +1263,487 @@ func verbMotion(vim *Vim, buffer Buffer, r Range) (err error) {
 	return
 }
 
-func verbDelete(vim *Vim, buffer Buffer, r Range) (err error) {
-	var spans []Span
+func verbOpenLineBelow(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if err = InsertLine(buffer, r.end.y+1, ""); err != nil {
+		return
+	}
+	return buffer.SetCursor(Point{0, r.end.y + 1})
+}
+
+func verbOpenLineAbove(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if err = InsertLine(buffer, r.end.y, ""); err != nil {
+		return
+	}
+	return buffer.SetCursor(Point{0, r.end.y})
+}
+
+func verbDelete(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r = exclusiveRange(buffer, r)
+	if !r.linewise && r.start == r.end {
+		// nothing to delete, such as when a motion found nothing
+		return
+	}
+	if err = vim.registers.Delete(action.register, rangeText(buffer, r)); err != nil {
+		return
+	}
+
+	if r.block {
+		for y := r.start.y; y <= r.end.y; y++ {
+			line := buffer.Lines()[y]
+			from, to := lineSpan(line, r, y)
+			if from < to {
+				if err = SetLine(buffer, y, line[:from]+line[to:]); err != nil {
+					return
+				}
+			}
+		}
+		return buffer.SetCursor(ClampIn(buffer, columnPoint(buffer, r.start.x, r.start.y)))
+	}
+
+	if r.linewise {
+		for l := r.start.y; l <= r.end.y; l++ {
+			if err = DeleteLine(buffer, r.start.y); err != nil {
+				return
+			}
+		}
+		// a buffer always has a line to put the cursor on
+		if len(buffer.Lines()) == 0 {
+			if err = InsertLine(buffer, 0, ""); err != nil {
+				return
+			}
+		}
+
+		y := Clamp(r.start.y, 0, len(buffer.Lines())-1)
+		return buffer.SetCursor(Point{firstNonBlank(buffer.Lines()[y]), y})
+	}
+
+	// join what is left of the first and last lines, dropping the lines between
+	lines := buffer.Lines()
+	joined := lines[r.start.y][:r.start.x] + lines[r.end.y][r.end.x:]
+	for l := r.start.y; l < r.end.y; l++ {
+		if err = DeleteLine(buffer, r.start.y+1); err != nil {
+			return
+		}
+	}
+	if err = SetLine(buffer, r.start.y, joined); err != nil {
+		return
+	}
+
+	return buffer.SetCursor(ClampIn(buffer, r.start))
+}
+
+// delete the range and start inserting in its place. changing whole lines
+// leaves an empty line to insert on, and changing a block inserts on each of
+// its lines
+func verbChange(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r = exclusiveRange(buffer, r)
+	everything := r.start.y == 0 && r.end.y == len(buffer.Lines())-1
+	var block *blockInsert
+	if r.block {
+		block = newBlockInsert(buffer, r.start.y, r.end.y, r.start.x, false)
+	}
+	if err = verbDelete(vim, action, buffer, r); err != nil {
+		return
+	}
+
+	switch {
+	case r.linewise:
+		// deleting every line already left an empty one
+		if !everything {
+			if err = InsertLine(buffer, r.start.y, ""); err != nil {
+				return
+			}
+		}
+		return buffer.SetCursor(Point{0, r.start.y})
+	case r.block:
+		vim.block_insert = block
+		return buffer.SetCursor(ClampOn(buffer, columnPoint(buffer, r.start.x, r.start.y)))
+	}
+	return buffer.SetCursor(ClampOn(buffer, r.start))
+}
+
+// join the lines in the range, leaving the cursor where the last join happened
+func verbJoin(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r.Sort()
+	cursor := buffer.Cursor()
+	for y := r.start.y; y < r.end.y; y++ {
+		cursor = Point{len(strings.TrimRightFunc(buffer.Lines()[r.start.y], unicode.IsSpace)), r.start.y}
+		if err = Join(buffer, r.start.y); err != nil {
+			return
+		}
+	}
+	return buffer.SetCursor(ClampIn(buffer, cursor))
+}
 
-	// calculate where the cursor will end, don't move it unless we are deleting up
-	end_cursor := buffer.Cursor()
-	if end_cursor.IsAfter(r.end) {
-		end_cursor.y = r.end.y
-		if r.start.y == r.end.y {
-			end_cursor.x = r.end.x
+// replace every character in the range with the verb's parameter
+func verbReplaceChar(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if r.start == r.end {
+		return
+	}
+
+	line := buffer.Lines()[r.start.y]
+	if action.verb.param == "\n" {
+		if err = SetLine(buffer, r.start.y, line[:r.start.x]+line[r.end.x:]); err != nil {
+			return
 		}
+		if err = SplitLine(buffer, r.start); err != nil {
+			return
+		}
+		return buffer.SetCursor(Point{0, r.start.y + 1})
+	}
+	replaced := strings.Repeat(action.verb.param, utf8.RuneCountInString(line[r.start.x:r.end.x]))
+	if err = SetLine(buffer, r.start.y, line[:r.start.x]+replaced+line[r.end.x:]); err != nil {
+		return
 	}
+	return buffer.SetCursor(Point{r.start.x + len(replaced) - len(action.verb.param), r.start.y})
+}
+
+func verbShiftRight(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return shift(vim, action, buffer, r, vim.settings.Indent)
+}
+
+func verbShiftLeft(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return shift(vim, action, buffer, r, vim.settings.Dedent)
+}
 
+// indent or dedent every line in the range, by a level for each count in
+// visual mode, and move the cursor to the first non blank of the first line
+func shift(vim *Vim, action *Action, buffer Buffer, r Range, change func(string) string) (err error) {
 	r.Sort()
+	levels := 1
+	if isVisual(action.mode) {
+		levels = action.Count()
+	}
 
-	// find line spans
-	for l := r.start.y; l <= r.end.y; l++ {
-		var span Span
+	for y := r.start.y; y <= r.end.y; y++ {
+		line := buffer.Lines()[y]
+		shifted := line
+		for i := 0; i < levels; i++ {
+			shifted = change(shifted)
+		}
+		if shifted != line {
+			if err = SetLine(buffer, y, shifted); err != nil {
+				return
+			}
+		}
+	}
+	return buffer.SetCursor(Point{firstNonBlank(buffer.Lines()[r.start.y]), r.start.y})
+}
 
-		// if we are on the starting line, use start.x, otherwise use the beginning of the line
-		if l == r.start.y {
-			span.start = r.start.x
-		} else {
-			span.start = 0
+func verbToggleCase(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return changeCase(vim, action, buffer, r, func(ch rune) rune {
+		if unicode.IsUpper(ch) {
+			return unicode.ToLower(ch)
 		}
+		return unicode.ToUpper(ch)
+	})
+}
+
+func verbUpperCase(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return changeCase(vim, action, buffer, r, unicode.ToUpper)
+}
+
+func verbLowerCase(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return changeCase(vim, action, buffer, r, unicode.ToLower)
+}
 
-		// if we are on the ending line, use end.x, otherwise use the end of the line
-		if l == r.end.y {
-			span.end = r.end.x
-		} else {
-			span.end = stringLastIndex(buffer.Lines()[l])
+// convert every character in the range. the cursor moves past the range in
+// normal mode, and to the start of the selection in visual mode
+func changeCase(vim *Vim, action *Action, buffer Buffer, r Range, convert func(rune) rune) (err error) {
+	r = exclusiveRange(buffer, r)
+	for y := r.start.y; y <= r.end.y; y++ {
+		line := buffer.Lines()[y]
+		from, to := lineSpan(line, r, y)
+		changed := line[:from] + strings.Map(convert, line[from:to]) + line[to:]
+		if changed != line {
+			if err = SetLine(buffer, y, changed); err != nil {
+				return
+			}
 		}
+	}
+
+	cursor := r.start
+	if !isVisual(action.mode) {
+		cursor = r.end
+	}
+	if r.block {
+		cursor = columnPoint(buffer, cursor.x, cursor.y)
+	}
+	return buffer.SetCursor(ClampIn(buffer, cursor))
+}
+
+// perform the last change at the cursor, typing the same text if it was an
+// insert. a count replaces the count the change was made with
+func verbRepeat(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if vim.last_change == nil {
+		return
+	}
+
+	change := *vim.last_change
+	if action.HasCount() {
+		change.multiplier = action.Count()
+		change.motion.multiplier = 0
+	}
+
+	vim.repeating = true
+	defer func() { vim.repeating = false }()
+
+	if err = vim.Perform(&change, buffer); err != nil || !isInserting(change.final_mode) {
+		return
+	}
+	if err = vim.replayInsert(buffer, vim.last_inserted); err != nil {
+		return
+	}
+	return vim.StopInsert(buffer)
+}
+
+func verbUndo(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if undoer, ok := buffer.(Undoer); ok {
+		err = undoer.Undo()
+	}
+	return
+}
+
+func verbRedo(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if undoer, ok := buffer.(Undoer); ok {
+		err = undoer.Redo()
+	}
+	return
+}
+
+// copy the text in the range into a register, moving the cursor to the start
+// of the range
+func verbYank(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r = exclusiveRange(buffer, r)
+	if err = vim.registers.Yank(action.register, rangeText(buffer, r)); err != nil {
+		return
+	}
 
-		spans = append(spans, span)
+	cursor := buffer.Cursor()
+	if r.linewise {
+		cursor.y = r.start.y
+	} else {
+		cursor = r.start
 	}
+	return buffer.SetCursor(ClampIn(buffer, cursor))
+}
+
+// put the register after the cursor, or below the line for whole lines
+func verbPutAfter(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return put(vim, action, buffer, true)
+}
+
+// put the register at the cursor, or above the line for whole lines
+func verbPutBefore(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	return put(vim, action, buffer, false)
+}
 
-	// set line or delete line for each span
-	deleted_lines := 0
-	for i, span := range spans {
-		line_index := r.start.y + i - deleted_lines
+func put(vim *Vim, action *Action, buffer Buffer, after bool) (err error) {
+	register, err := vim.registers.Get(action.register)
+	if err != nil {
+		return
+	}
 
-		if span.start == 0 && span.end == stringLastIndex(buffer.Lines()[line_index]) {
-			// the range included the entire line, so just remove it
-			DeleteLine(buffer, line_index)
-			deleted_lines += 1
-		} else {
-			// just delete a range of characters within the line
-			line := buffer.Lines()[line_index]
-			new_line := line[0:span.start] + line[span.end:len(line)]
-			SetLine(buffer, line_index, new_line)
+	// the text is put once for each count
+	text := register
+	for i := 1; i < action.Count(); i++ {
+		text = text.Append(register)
+	}
+
+	cursor := buffer.Cursor()
+	if register.blockwise {
+		return putBlock(buffer, register, action.Count(), after)
+	}
+	if text.linewise {
+		y := cursor.y
+		if after {
+			y++
+		}
+		for i, line := range text.lines {
+			if err = InsertLine(buffer, y+i, line); err != nil {
+				return
+			}
+		}
+		return buffer.SetCursor(Point{firstNonBlank(text.lines[0]), y})
+	}
+
+	line := buffer.Lines()[cursor.y]
+	x := Clamp(cursor.x, 0, len(line))
+	if after && x < len(line) {
+		next, _ := nextPoint(buffer, Point{x, cursor.y})
+		x = next.x
+	}
+
+	// splice the text into the line, splitting it at each line break
+	last := len(text.lines) - 1
+	if err = SetLine(buffer, cursor.y, line[:x]+text.lines[0]); err != nil {
+		return
+	}
+	for i := 1; i <= last; i++ {
+		if err = InsertLine(buffer, cursor.y+i, text.lines[i]); err != nil {
+			return
+		}
+	}
+	end := Point{len(buffer.Lines()[cursor.y+last]), cursor.y + last}
+	if err = SetLine(buffer, end.y, buffer.Lines()[end.y]+line[x:]); err != nil {
+		return
+	}
+
+	// the cursor ends on the last character put, or the first if it spans lines
+	if last > 0 {
+		return buffer.SetCursor(Point{x, cursor.y})
+	}
+	end, _ = prevPoint(buffer, end)
+	return buffer.SetCursor(ClampIn(buffer, end))
+}
+
+// put each line of a block at the same column on successive lines, count
+// times side by side, adding lines to the end of the buffer if it runs out
+func putBlock(buffer Buffer, register Register, count int, after bool) (err error) {
+	cursor := buffer.Cursor()
+	x := Clamp(cursor.x, 0, len(buffer.Lines()[cursor.y]))
+	if after && x < len(buffer.Lines()[cursor.y]) {
+		next, _ := nextPoint(buffer, Point{x, cursor.y})
+		x = next.x
+	}
+
+	column := charColumn(buffer.Lines()[cursor.y], x)
+
+	// short lines of the block are padded so the block keeps its shape
+	width := 0
+	for _, line := range register.lines {
+		if length := utf8.RuneCountInString(line); length > width {
+			width = length
+		}
+	}
+
+	for i, text := range register.lines {
+		y := cursor.y + i
+		if y >= len(buffer.Lines()) {
+			if err = InsertLine(buffer, y, ""); err != nil {
+				return
+			}
+		}
+		if err = padLine(buffer, y, column); err != nil {
+			return
+		}
+
+		line := buffer.Lines()[y]
+		at := columnByte(line, column)
+		text = strings.Repeat(text+strings.Repeat(" ", width-utf8.RuneCountInString(text)), count)
+		if at == len(line) {
+			text = strings.TrimRight(text, " ")
+		}
+		if err = SetLine(buffer, y, line[:at]+text+line[at:]); err != nil {
+			return
 		}
 	}
+	return buffer.SetCursor(Point{x, cursor.y})
+}
 
-	// update the cursor
-	buffer.SetCursor(ClampIn(buffer, end_cursor))
+// sort a range and make it end just after the last character in it. a block
+// is made to run from the column of its top left to just after the column of
+// its bottom right
+func exclusiveRange(buffer Buffer, r Range) Range {
+	r.Sort()
+	if r.block {
+		if !r.inclusive {
+			// already made exclusive
+			return r
+		}
+		lines := buffer.Lines()
+		left, right := charColumn(lines[r.start.y], r.start.x), charColumn(lines[r.end.y], r.end.x)
+		if left > right {
+			left, right = right, left
+		}
+		return Range{start: Point{left, r.start.y}, end: Point{right + 1, r.end.y}, block: true}
+	}
+	if r.inclusive {
+		r.end, _ = nextPoint(buffer, r.end)
+		r.inclusive = false
+	}
+	return r
+}
+
+// the text in an exclusive range
+func rangeText(buffer Buffer, r Range) Register {
+	lines := buffer.Lines()
+	if r.linewise {
+		return Register{lines: append([]string{}, lines[r.start.y:r.end.y+1]...), linewise: true}
+	}
+	if r.block {
+		var text []string
+		for y := r.start.y; y <= r.end.y; y++ {
+			from, to := lineSpan(lines[y], r, y)
+			text = append(text, lines[y][from:to])
+		}
+		return Register{lines: text, blockwise: true}
+	}
+	if r.start.y == r.end.y {
+		return Register{lines: []string{lines[r.start.y][r.start.x:r.end.x]}}
+	}
+
+	text := []string{lines[r.start.y][r.start.x:]}
+	text = append(text, lines[r.start.y+1:r.end.y]...)
+	return Register{lines: append(text, lines[r.end.y][:r.end.x])}
+}
+
+// the part of line y an exclusive range covers. the columns of a block are cut
+// to the line
+func lineSpan(line string, r Range, y int) (from int, to int) {
+	switch {
+	case r.linewise:
+		return 0, len(line)
+	case r.block:
+		return columnByte(line, r.start.x), columnByte(line, r.end.x)
+	}
+
+	from, to = 0, len(line)
+	if y == r.start.y {
+		from = r.start.x
+	}
+	if y == r.end.y {
+		to = r.end.x
+	}
 	return
 }
 
+// returns true when the action changes the buffer, which is what . repeats
+func isChange(action *Action) bool {
+	if isInserting(action.final_mode) {
+		return true
+	}
+	for _, verb := range []VerbFunc{verbMotion, verbYank, verbUndo, verbRedo, verbRepeat, verbRecord, verbPlay, verbVisual, verbSwapSelection, verbSelectObject} {
+		if isVerb(action, verb) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true when the action only moves the cursor rather than operating on the text
+func isMotionOnly(action *Action) bool {
+	return isVerb(action, verbMotion)
+}
+
+// returns true when verb is the action's verb
+func isVerb(action *Action, verb VerbFunc) bool {
+	return reflect.ValueOf(action.verb.function).Pointer() == reflect.ValueOf(verb).Pointer()
+}
+
+// returns true when motion is the action's motion
+func isMotion(action *Action, motion MotionFunc) bool {
+	return reflect.ValueOf(action.motion.function).Pointer() == reflect.ValueOf(motion).Pointer()
+}
+
+// the index of the first character on the line which isn't white space
+func firstNonBlank(line string) int {
+	return len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+}
+
 // helpers
+// the index of the first byte of the last character in str, 0 if it's empty
 func stringLastIndex(str string) (index int) {
-	result := len(str)
-	if result > 0 {
-		result -= 1
-	}
-	return result
+	_, size := utf8.DecodeLastRuneInString(str)
+	return len(str) - size
 }
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+	"strings"
+	"testing"
+)
+
+// feed keys to vim in normal mode, performing each completed action
+func performKeys(t *testing.T, vim *Vim, buffer Buffer, keys string) {
+	for _, key := range keys {
+		state, action := vim.ParseAction(key)
+		if state == PARSE_ACTION_STATE_INVALID {
+			t.Fatalf("invalid key '%c' in '%s'", key, keys)
+		} else if state == PARSE_ACTION_STATE_COMPLETE {
+			if err := vim.Perform(&action, buffer); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func newTestBuffer(contents string) Undoer {
+	buffer := NewUndoer(&BaseBuffer{})
+	Load(buffer, strings.NewReader(contents))
+	return buffer
+}
+
+// keys typed on a buffer with the cursor at cursor, and the buffer and cursor
+// they should leave
+type keysTest struct {
+	contents string
+	cursor   Point
+	keys     string
+	expected string
+	final    Point
+}
+
+// type each test's keys with typeKeys on a new vim and buffer, then call check,
+// if any, with the vim it left for any further checks
+func runKeysTests(t *testing.T, tests []keysTest, typeKeys func(*testing.T, *Vim, Buffer, string), check func(vim *Vim, test keysTest)) {
+	for _, test := range tests {
+		var vim Vim
+		vim.init()
+		buffer := newTestBuffer(test.contents)
+		buffer.SetCursor(test.cursor)
+		typeKeys(t, &vim, buffer, test.keys)
+		if StringifyBuffer(buffer) != test.expected+"\n" || buffer.Cursor() != test.final {
+			t.Errorf("%q cursor %v after %q on %q, expected %q cursor %v",
+				StringifyBuffer(buffer), buffer.Cursor(), test.keys, test.contents, test.expected, test.final)
+		}
+		if check != nil {
+			check(&vim, test)
+		}
+	}
+}
+
+func TestInsertMode(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("line0\nline1")
+
+	performKeys(t, &vim, buffer, "A")
+	if vim.mode != MODE_INSERT || buffer.Cursor() != (Point{5, 0}) {
+		t.Fatalf("mode %v cursor %v after A", vim.mode, buffer.Cursor())
+	}
+
+	vim.InsertText(buffer, "ab")
+	vim.InsertNewline(buffer)
+	vim.InsertText(buffer, "c")
+	vim.InsertBackspace(buffer)
+	vim.InsertText(buffer, "d")
+	vim.StopInsert(buffer)
+
+	if expected := "line0ab\nd\nline1"; StringifyBuffer(buffer) != expected+"\n" {
+		t.Fatalf("buffer '%s', expected '%s'", StringifyBuffer(buffer), expected)
+	}
+	if vim.mode != MODE_NORMAL || buffer.Cursor() != (Point{0, 1}) {
+		t.Fatalf("mode %v cursor %v after escape", vim.mode, buffer.Cursor())
+	}
+
+	// the whole insert is undone at once
+	buffer.Undo()
+	if expected := "line0\nline1\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after undo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// opening a line is part of the insert too
+	performKeys(t, &vim, buffer, "O")
+	vim.InsertText(buffer, "new")
+	vim.StopInsert(buffer)
+	buffer.Undo()
+	if expected := "line0\nline1\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after undo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// escape steps back over the whole of a multibyte character
+	buffer = newTestBuffer("héllo")
+	performKeys(t, &vim, buffer, "i")
+	vim.InsertText(buffer, "é")
+	vim.StopInsert(buffer)
+	if buffer.Cursor() != (Point{0, 0}) {
+		t.Fatalf("cursor %v after inserting é, expected {0 0}", buffer.Cursor())
+	}
+	performKeys(t, &vim, buffer, "i")
+	vim.InsertText(buffer, "X")
+	vim.StopInsert(buffer)
+	if expected := "Xéhéllo\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after inserting X, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("line0\nline1\nline2\nline3\nline4\nline5")
+
+	performKeys(t, &vim, buffer, "3j2l")
+	if buffer.Cursor() != (Point{2, 3}) {
+		t.Fatalf("cursor %v after 3j2l, expected {2 3}", buffer.Cursor())
+	}
+
+	// 0 is a count once one has been started, otherwise the start of the line
+	performKeys(t, &vim, buffer, "0")
+	if buffer.Cursor() != (Point{0, 3}) {
+		t.Fatalf("cursor %v after 0, expected {0 3}", buffer.Cursor())
+	}
+	performKeys(t, &vim, buffer, "10k")
+	if buffer.Cursor() != (Point{0, 0}) {
+		t.Fatalf("cursor %v after 10k, expected {0 0}", buffer.Cursor())
+	}
+
+	performKeys(t, &vim, buffer, "2dd")
+	if expected := "line2\nline3\nline4\nline5\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after 2dd, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// deleting past the last line stops at the end of the buffer
+	performKeys(t, &vim, buffer, "jd5j")
+	if expected := "line2\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after d5j, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// each action is undone in one go
+	buffer.Undo()
+	if expected := "line2\nline3\nline4\nline5\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after undo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestWordMotions(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("foo.bar(baz) qux\n\n  last_word, end")
+
+	tests := []struct {
+		keys     string
+		expected Point
+	}{
+		{"w", Point{3, 0}},
+		{"w", Point{4, 0}},
+		{"2w", Point{8, 0}},
+		{"W", Point{13, 0}},
+		{"w", Point{0, 1}},
+		{"w", Point{2, 2}},
+		{"e", Point{10, 2}},
+		{"E", Point{11, 2}},
+		{"b", Point{2, 2}},
+		{"b", Point{0, 1}},
+		{"B", Point{13, 0}},
+		{"3b", Point{7, 0}},
+		{"ge", Point{6, 0}},
+		{"gE", Point{0, 0}},
+		{"9w", Point{11, 2}},
+		{"20w", Point{15, 2}},
+	}
+	for _, test := range tests {
+		performKeys(t, &vim, buffer, test.keys)
+		if buffer.Cursor() != test.expected {
+			t.Fatalf("cursor %v after %s, expected %v", buffer.Cursor(), test.keys, test.expected)
+		}
+	}
+}
+
+func TestDeleteWords(t *testing.T) {
+	tests := []struct {
+		contents string
+		cursor   Point
+		keys     string
+		expected string
+	}{
+		{"foo bar baz", Point{0, 0}, "dw", "bar baz"},
+		{"foo bar baz", Point{4, 0}, "d2w", "foo "},
+		{"foo bar baz", Point{0, 0}, "2d2w", ""},
+		{"foo bar\nbaz", Point{4, 0}, "dw", "foo \nbaz"},
+		{"foo bar\nbaz", Point{4, 0}, "de", "foo \nbaz"},
+		{"foo bar\n  baz qux", Point{4, 0}, "d2w", "foo qux"},
+		{"foo bar baz", Point{8, 0}, "db", "foo baz"},
+		{"foo-bar baz", Point{0, 0}, "dW", "baz"},
+		{"foo-bar baz", Point{0, 0}, "dE", " baz"},
+		{"foo bar baz", Point{8, 0}, "dge", "foo baaz"},
+	}
+	for _, test := range tests {
+		var vim Vim
+		vim.init()
+		buffer := newTestBuffer(test.contents)
+		buffer.SetCursor(test.cursor)
+		performKeys(t, &vim, buffer, test.keys)
+		if StringifyBuffer(buffer) != test.expected+"\n" {
+			t.Errorf("'%s' after %s on '%s', expected '%s'", StringifyBuffer(buffer), test.keys, test.contents, test.expected)
+		}
+	}
+}
+
+func TestLineMotionAtEdge(t *testing.T) {
+	tests := []struct {
+		cursor Point
+		keys   string
+	}{
+		{Point{0, 2}, "j"},
+		{Point{0, 2}, "dj"},
+		{Point{0, 2}, "3yj"},
+		{Point{0, 0}, "k"},
+		{Point{0, 0}, "dk"},
+		{Point{0, 0}, "2ck"},
+	}
+	for _, test := range tests {
+		var vim Vim
+		vim.init()
+		buffer := newTestBuffer("a\nb\nc")
+		buffer.SetCursor(test.cursor)
+		keys := []rune(test.keys)
+		performKeys(t, &vim, buffer, string(keys[:len(keys)-1]))
+		state, action := vim.ParseAction(keys[len(keys)-1])
+		if state != PARSE_ACTION_STATE_COMPLETE || vim.Perform(&action, buffer) == nil {
+			t.Errorf("%q on line %d succeeded", test.keys, test.cursor.y)
+		}
+		if StringifyBuffer(buffer) != "a\nb\nc\n" || buffer.Cursor() != test.cursor || vim.mode != MODE_NORMAL {
+			t.Errorf("%q left %q cursor %v mode %v", test.keys, StringifyBuffer(buffer), buffer.Cursor(), vim.mode)
+		}
+	}
+}
+
+func TestLineKeys(t *testing.T) {
+	tests := []keysTest{
+		{"a\nb\nc\nd", Point{0, 1}, "dG", "a", Point{0, 0}},
+		{"a\nb\nc\nd", Point{0, 2}, "dgg", "d", Point{0, 0}},
+		{"a\nb\nc\nd", Point{0, 0}, "d2G", "c\nd", Point{0, 0}},
+		{"a\nb\n  c\nd", Point{0, 0}, "3G", "a\nb\n  c\nd", Point{2, 2}},
+		{"foo bar", Point{4, 0}, "d$", "foo ", Point{3, 0}},
+		{"foo bar\nbaz\nqux", Point{4, 0}, "2d$", "foo \nqux", Point{3, 0}},
+		{"foo bar", Point{4, 0}, "d0", "bar", Point{0, 0}},
+		{"foo bar", Point{0, 0}, "$", "foo bar", Point{6, 0}},
+		{"aé", Point{0, 0}, "$", "aé", Point{1, 0}},
+		{"aé", Point{0, 0}, "$dl", "a", Point{0, 0}},
+		{"aé", Point{0, 0}, "$rx", "ax", Point{1, 0}},
+		{"a\n  b\nc\nd", Point{0, 0}, "3J", "a b c\nd", Point{3, 0}},
+		{"a\nb", Point{0, 0}, "J", "a b", Point{1, 0}},
+		{"abcd", Point{1, 0}, "3rx", "axxx", Point{3, 0}},
+		{"abcd", Point{1, 0}, "4rx", "abcd", Point{1, 0}},
+	}
+	runKeysTests(t, tests, performKeys, nil)
+}
+
+func TestUndoRedo(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("a\nb\nc\nd")
+	buffer.SetCursor(Point{0, 1})
+
+	performKeys(t, &vim, buffer, "2ddrx")
+	if expected := "a\nx\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s', expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	performKeys(t, &vim, buffer, "2u")
+	if expected := "a\nb\nc\nd\n"; StringifyBuffer(buffer) != expected || buffer.Cursor() != (Point{0, 1}) {
+		t.Fatalf("buffer '%s' cursor %v after 2u, expected '%s'", StringifyBuffer(buffer), buffer.Cursor(), expected)
+	}
+
+	// redo replays the changes in the order they were made
+	performKeys(t, &vim, buffer, string(KEY_CTRL_R))
+	if expected := "a\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after redo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+	performKeys(t, &vim, buffer, string(KEY_CTRL_R)+string(KEY_CTRL_R))
+	if expected := "a\nx\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after redo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// the new line has to be inserted before the text typed on it
+	performKeys(t, &vim, buffer, "O")
+	vim.InsertText(buffer, "new")
+	vim.StopInsert(buffer)
+	performKeys(t, &vim, buffer, "u"+string(KEY_CTRL_R))
+	if expected := "a\nnew\nx\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after redo, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestYankPut(t *testing.T) {
+	tests := []keysTest{
+		{"foo bar", Point{0, 0}, "ywP", "foo foo bar", Point{3, 0}},
+		{"foo bar", Point{0, 0}, "yw$p", "foo barfoo ", Point{10, 0}},
+		{"foo bar", Point{4, 0}, "yb", "foo bar", Point{0, 0}},
+		{"a\nb", Point{0, 0}, "yyjp", "a\nb\na", Point{0, 2}},
+		{"a\n  b", Point{0, 1}, "YkP", "  b\na\n  b", Point{2, 0}},
+		{"a\nb", Point{0, 0}, "3yy", "a\nb", Point{0, 0}},
+		{"a\nb\nc", Point{0, 0}, "ddp", "b\na\nc", Point{0, 1}},
+		{"a\nb\nc", Point{0, 0}, "2yyG2p", "a\nb\nc\na\nb\na\nb", Point{0, 3}},
+		{"abc", Point{0, 0}, "dl2p", "baac", Point{2, 0}},
+		{"foo bar\nbaz", Point{4, 0}, "dwjp", "foo \nbazbar", Point{5, 1}},
+		{"foo bar\nbaz", Point{4, 0}, "d2wP", "foobar\nbaz ", Point{3, 0}},
+		{"one two", Point{0, 0}, "\"ayw\"_dw\"aP", "one two", Point{3, 0}},
+		{"one two", Point{0, 0}, "\"ayww\"Ayw\"ap", "one tone twowo", Point{11, 0}},
+	}
+	runKeysTests(t, tests, performKeys, nil)
+}
+
+// type text in insert mode and press escape
+func typeInsert(t *testing.T, vim *Vim, buffer Buffer, text string) {
+	for _, key := range text {
+		var err error
+		switch key {
+		case '\n':
+			err = vim.InsertNewline(buffer)
+		case '\b':
+			err = vim.InsertBackspace(buffer)
+		default:
+			err = vim.InsertText(buffer, string(key))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vim.StopInsert(buffer); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("one two three four five\na\nb\nc\nd")
+
+	performKeys(t, &vim, buffer, "dw.")
+	if expected := "three four five\na\nb\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after dw., expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// a count replaces the original one, and moving doesn't replace the change
+	performKeys(t, &vim, buffer, "l0")
+	performKeys(t, &vim, buffer, "2.")
+	if expected := "five\na\nb\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after 2., expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// inserts type the same text again, each repeat is undone in one go
+	performKeys(t, &vim, buffer, "A")
+	typeInsert(t, &vim, buffer, "!x\b?\nnew")
+	performKeys(t, &vim, buffer, "j.")
+	if expected := "five!?\nnew\na!?\nnew\nb\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after A., expected '%s'", StringifyBuffer(buffer), expected)
+	}
+	buffer.Undo()
+	if expected := "five!?\nnew\na\nb\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after undoing ., expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// counts on inserts type the text count times
+	buffer.SetCursor(Point{0, 3})
+	performKeys(t, &vim, buffer, "2o")
+	typeInsert(t, &vim, buffer, "x")
+	performKeys(t, &vim, buffer, "3i")
+	typeInsert(t, &vim, buffer, "y")
+	if expected := "five!?\nnew\na\nb\nx\nyyyx\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after counted inserts, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+
+	// the register is used again
+	buffer.SetCursor(Point{0, 0})
+	performKeys(t, &vim, buffer, "\"add.\"ap")
+	if expected := "a\nnew\nb\nx\nyyyx\nc\nd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer '%s' after repeating a delete into a register, expected '%s'", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := []keysTest{
+		{"abcd", Point{1, 0}, "Rxy\x1b", "axyd", Point{2, 0}},
+		{"ab", Point{1, 0}, "Rxyz\x1b", "axyz", Point{3, 0}},
+		{"abcd", Point{1, 0}, "Rxy\b\b\b\x1b", "abcd", Point{0, 0}},
+		{"ab", Point{0, 0}, "Rx\ry\b\b\x1b", "xb", Point{0, 0}},
+		{"abcdef", Point{0, 0}, "2Rxy\x1b", "xyxyef", Point{3, 0}},
+		{"abcd\nefgh", Point{0, 0}, "Rxy\x1bj0.", "xycd\nxygh", Point{1, 1}},
+		{"abcd", Point{0, 0}, "3rx", "xxxd", Point{2, 0}},
+		{"ab", Point{0, 0}, "3rx", "ab", Point{0, 0}},
+		{"ab cd", Point{1, 0}, "2r\r", "a\ncd", Point{0, 1}},
+	}
+	runKeysTests(t, tests, handleKeys, nil)
+
+	// replacing is undone in one go
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("abcd")
+	handleKeys(t, &vim, buffer, "Rxyz\x1b03rwu")
+	if expected := "xyzd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after undoing r, expected %q", StringifyBuffer(buffer), expected)
+	}
+	handleKeys(t, &vim, buffer, "u")
+	if expected := "abcd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after undoing R, expected %q", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestReplaceWithEnterKey(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("ab cd")
+	buffer.SetCursor(Point{2, 0})
+
+	// enter is ctrl-m to termbox, which the layout uses unless vim is waiting
+	// for the rest of a command
+	enter := termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter}
+	if vimWantsKey(&vim, enter) {
+		t.Fatal("enter in normal mode should go to the layout")
+	}
+	handleKeys(t, &vim, buffer, "r")
+	if !vimWantsKey(&vim, enter) {
+		t.Fatal("enter after r should go to vim")
+	}
+	handleKeys(t, &vim, buffer, string(vimKey(enter)))
+	if expected := "ab\ncd\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after r<CR>, expected %q", StringifyBuffer(buffer), expected)
+	}
+}
+
+func TestChange(t *testing.T) {
+	tests := []keysTest{
+		{"foo bar", Point{0, 0}, "cwbaz\x1b", "baz bar", Point{2, 0}},
+		{"foo bar", Point{2, 0}, "cwX\x1b", "foX bar", Point{2, 0}},
+		{"foo bar baz", Point{0, 0}, "c2wX\x1b", "X baz", Point{0, 0}},
+		{"foo bar", Point{3, 0}, "cwX\x1b", "fooXbar", Point{3, 0}},
+		{"a\nb\nc", Point{0, 1}, "ccX\x1b", "a\nX\nc", Point{0, 1}},
+		{"a\nb\nc", Point{0, 0}, "2SX\x1b", "X\nc", Point{0, 0}},
+		{"a\nb", Point{0, 0}, "cGX\x1b", "X", Point{0, 0}},
+		{"foo bar", Point{4, 0}, "CX\x1b", "foo X", Point{4, 0}},
+		{"abcd", Point{1, 0}, "2sX\x1b", "aXd", Point{1, 0}},
+		{"foo foo", Point{0, 0}, "cwbar\x1bw.", "bar bar", Point{6, 0}},
+		{"a\nb\nc", Point{0, 0}, "vjSX\x1b", "X\nc", Point{0, 0}},
+	}
+	runKeysTests(t, tests, handleKeys, nil)
+}
+
+func TestFindCharacter(t *testing.T) {
+	tests := []keysTest{
+		{"a,b,c,d", Point{0, 0}, "f,", "a,b,c,d", Point{1, 0}},
+		{"a,b,c,d", Point{0, 0}, "f,;", "a,b,c,d", Point{3, 0}},
+		{"a,b,c,d", Point{0, 0}, "f,;,", "a,b,c,d", Point{1, 0}},
+		{"a,b,c,d", Point{0, 0}, "f,2;", "a,b,c,d", Point{5, 0}},
+		{"a,b,c,d", Point{0, 0}, "3f,", "a,b,c,d", Point{5, 0}},
+		{"abcabc", Point{5, 0}, "Fa", "abcabc", Point{3, 0}},
+		{"abcabc", Point{5, 0}, "Ta", "abcabc", Point{4, 0}},
+		{"abcabc", Point{0, 0}, "tc;", "abcabc", Point{4, 0}},
+		{"foo(bar)", Point{0, 0}, "dt)", ")", Point{0, 0}},
+		{"a,b,c", Point{0, 0}, "cf,X\x1b", "Xb,c", Point{0, 0}},
+		{"abcabc", Point{5, 0}, "dFa", "abcc", Point{3, 0}},
+		{"a b c", Point{0, 0}, "d2f ", "c", Point{0, 0}},
+		{"a,b,c", Point{0, 0}, "vf,;d", "c", Point{0, 0}},
+	}
+	runKeysTests(t, tests, handleKeys, nil)
+}
+
+func TestFindCharacterNotFound(t *testing.T) {
+	tests := []struct {
+		keys string
+		mode Mode
+	}{
+		{"4f,", MODE_NORMAL},
+		{"dfz", MODE_NORMAL},
+		{"cfz", MODE_NORMAL},
+		{"ctz", MODE_NORMAL},
+		{";", MODE_NORMAL},
+		{"vfz", MODE_VISUAL_RANGE},
+	}
+	for _, test := range tests {
+		var vim Vim
+		vim.init()
+		buffer := newTestBuffer("a,b,c,d")
+		keys := []rune(test.keys)
+		handleKeys(t, &vim, buffer, string(keys[:len(keys)-1]))
+		if err := vim.HandleKey(keys[len(keys)-1], buffer); err == nil {
+			t.Errorf("%q succeeded", test.keys)
+		}
+		if StringifyBuffer(buffer) != "a,b,c,d\n" || buffer.Cursor() != (Point{0, 0}) || vim.mode != test.mode {
+			t.Errorf("%q left %q cursor %v mode %v", test.keys, StringifyBuffer(buffer), buffer.Cursor(), vim.mode)
+		}
+	}
+}
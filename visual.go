@@ -0,0 +1,277 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// visual mode selects the text between where it was started and the cursor,
+// which motions move to extend the selection. operators work on the selection
+// straight away instead of waiting for a motion. a block selects the same
+// columns on every line between the two. the columns of a block are counted in
+// characters rather than bytes, so blocks line up over multibyte text
+
+// the text selected in a view, which is drawn in reverse video
+type Selection struct {
+	// one of the visual modes, or MODE_NORMAL when nothing is selected
+	mode  Mode
+	start Point
+	end   Point
+	// the first and last columns of a block
+	left  int
+	right int
+}
+
+// an insert made on every line of a block, which StopInsert copies from the
+// first line to the others
+type blockInsert struct {
+	top    int
+	bottom int
+	column int
+	// pad lines which don't reach the column out to it, rather than skipping them
+	pad bool
+	// whether each line had text at the column before the change, which
+	// may have deleted it
+	reaches []bool
+}
+
+// an insert on the lines from top to bottom at column. made before any of the
+// block is deleted, so a change skips the same lines an insert would
+func newBlockInsert(buffer Buffer, top int, bottom int, column int, pad bool) *blockInsert {
+	block := &blockInsert{top: top, bottom: bottom, column: column, pad: pad}
+	for y := top; y <= bottom; y++ {
+		block.reaches = append(block.reaches, utf8.RuneCountInString(buffer.Lines()[y]) > column)
+	}
+	return block
+}
+
+func isVisual(mode Mode) bool {
+	return mode == MODE_VISUAL_RANGE || mode == MODE_VISUAL_LINE || mode == MODE_VISUAL_BLOCK
+}
+
+// the selection between where visual mode was started and the cursor
+func (vim *Vim) Selection(buffer Buffer, cursor Point) Selection {
+	if !isVisual(vim.mode) {
+		return Selection{}
+	}
+	selection := Selection{mode: vim.mode, start: vim.visual_start, end: cursor}
+	if vim.mode == MODE_VISUAL_BLOCK {
+		start, end := ClampIn(buffer, selection.start), ClampIn(buffer, selection.end)
+		selection.left = charColumn(buffer.Lines()[start.y], start.x)
+		selection.right = charColumn(buffer.Lines()[end.y], end.x)
+		if selection.left > selection.right {
+			selection.left, selection.right = selection.right, selection.left
+		}
+	}
+	return selection
+}
+
+// returns true if the character at p, which is column characters into its
+// line, is selected
+func (selection *Selection) Contains(p Point, column int) bool {
+	start, end := selection.start, selection.end
+	if start.IsAfter(end) {
+		start, end = end, start
+	}
+	if p.y < start.y || p.y > end.y {
+		return false
+	}
+
+	switch selection.mode {
+	case MODE_VISUAL_RANGE:
+		return !start.IsAfter(p) && !p.IsAfter(end)
+	case MODE_VISUAL_LINE:
+		return true
+	case MODE_VISUAL_BLOCK:
+		return column >= selection.left && column <= selection.right
+	}
+	return false
+}
+
+// remember the selection for the '< and '> marks
+func (vim *Vim) markSelection(buffer Buffer) {
+	vim.last_selection = vim.Selection(buffer, buffer.Cursor())
+}
+
+// leave visual mode, remembering the selection
+func (vim *Vim) StopVisual(buffer Buffer) {
+	vim.markSelection(buffer)
+	vim.mode = MODE_NORMAL
+	vim.command = []rune{}
+}
+
+// the first and last lines of the last selection, which the '< and '> marks
+// refer to. returns false if nothing has been selected yet
+func (vim *Vim) SelectionMarks() (top int, bottom int, ok bool) {
+	selection := vim.last_selection
+	if selection.mode == MODE_NORMAL {
+		return 0, 0, false
+	}
+	top, bottom = selection.start.y, selection.end.y
+	if top > bottom {
+		top, bottom = bottom, top
+	}
+	return top, bottom, true
+}
+
+func parseVisualRange(action *Action) ParseActionState {
+	return parseVisual(action, MODE_VISUAL_RANGE)
+}
+
+func parseVisualLine(action *Action) ParseActionState {
+	return parseVisual(action, MODE_VISUAL_LINE)
+}
+
+func parseVisualBlock(action *Action) ParseActionState {
+	return parseVisual(action, MODE_VISUAL_BLOCK)
+}
+
+// start selecting, switch to another kind of selection, or stop selecting if
+// typed again in the same visual mode
+func parseVisual(action *Action, mode Mode) ParseActionState {
+	if action.verb.function != nil {
+		return PARSE_ACTION_STATE_INVALID
+	}
+	action.motion.function = motionNone
+	action.verb.function = verbVisual
+	action.final_mode = mode
+	if action.mode == mode {
+		action.final_mode = MODE_NORMAL
+	}
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// perform verb on the selection and leave visual mode
+func parseSelection(action *Action, verb VerbFunc) ParseActionState {
+	action.motion.function = motionSelection
+	action.verb.function = verb
+	action.final_mode = MODE_NORMAL
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// I and A in a block insert on every line of it, before or after the block
+func parseBlockInsert(action *Action, verb VerbFunc) ParseActionState {
+	action.motion.function = motionSelection
+	action.verb.function = verb
+	action.final_mode = MODE_INSERT
+	return PARSE_ACTION_STATE_COMPLETE
+}
+
+// the selected text. blocks are inclusive ranges with block set
+func motionSelection(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r.start = ClampIn(buffer, vim.visual_start)
+	r.end = buffer.Cursor()
+	switch action.mode {
+	case MODE_VISUAL_LINE:
+		r.linewise = true
+	case MODE_VISUAL_BLOCK:
+		r.block = true
+		r.inclusive = true
+	default:
+		r.inclusive = true
+	}
+	return r
+}
+
+// every line with part of the selection on it
+func motionSelectedLines(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = motionSelection(vim, action, buffer)
+	r.linewise = true
+	r.inclusive = false
+	r.block = false
+	return r
+}
+
+// the selected lines, which for J is at least two
+func motionJoinSelection(vim *Vim, action *Action, buffer Buffer) (r Range) {
+	r = motionSelection(vim, action, buffer)
+	r.Sort()
+	if r.start.y == r.end.y {
+		r.end.y = Clamp(r.end.y+1, 0, len(buffer.Lines())-1)
+	}
+	r.linewise = true
+	return r
+}
+
+func verbVisual(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	if action.mode == MODE_NORMAL {
+		vim.visual_start = ClampIn(buffer, buffer.Cursor())
+	}
+	return
+}
+
+// move the cursor to the other end of the selection
+func verbSwapSelection(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	cursor := buffer.Cursor()
+	if err = buffer.SetCursor(ClampIn(buffer, vim.visual_start)); err == nil {
+		vim.visual_start = cursor
+	}
+	return
+}
+
+func verbBlockInsert(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r = exclusiveRange(buffer, r)
+	vim.block_insert = newBlockInsert(buffer, r.start.y, r.end.y, r.start.x, false)
+	return buffer.SetCursor(ClampOn(buffer, columnPoint(buffer, r.start.x, r.start.y)))
+}
+
+func verbBlockAppend(vim *Vim, action *Action, buffer Buffer, r Range) (err error) {
+	r = exclusiveRange(buffer, r)
+	vim.block_insert = newBlockInsert(buffer, r.start.y, r.end.y, r.end.x, true)
+	if err = padLine(buffer, r.start.y, r.end.x); err != nil {
+		return
+	}
+	return buffer.SetCursor(columnPoint(buffer, r.end.x, r.start.y))
+}
+
+// type keys on every line of a block below the first, where they were typed
+func (vim *Vim) insertOnBlock(buffer Buffer, block *blockInsert, keys []rune) (err error) {
+	for y := block.top + 1; y <= block.bottom; y++ {
+		if block.pad {
+			if err = padLine(buffer, y, block.column); err != nil {
+				return
+			}
+		} else if !block.reaches[y-block.top] {
+			continue
+		}
+		if err = buffer.SetCursor(columnPoint(buffer, block.column, y)); err != nil {
+			return
+		}
+		if err = vim.replayInsert(buffer, keys); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// add spaces to the end of a line until it is at least width characters long
+func padLine(buffer Buffer, y int, width int) error {
+	line := buffer.Lines()[y]
+	length := utf8.RuneCountInString(line)
+	if length >= width {
+		return nil
+	}
+	return SetLine(buffer, y, line+strings.Repeat(" ", width-length))
+}
+
+// the column of the character at byte x of line
+func charColumn(line string, x int) int {
+	return utf8.RuneCountInString(line[:Clamp(x, 0, len(line))])
+}
+
+// the byte where a column starts on line, or the end of the line if it is
+// shorter than that
+func columnByte(line string, column int) int {
+	for x := range line {
+		if column == 0 {
+			return x
+		}
+		column--
+	}
+	return len(line)
+}
+
+// the point at a column on line y
+func columnPoint(buffer Buffer, column int, y int) Point {
+	return Point{columnByte(buffer.Lines()[y], column), y}
+}
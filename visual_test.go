@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVisualModes(t *testing.T) {
+	tests := []keysTest{
+		{"foo bar baz", Point{4, 0}, "ved", "foo  baz", Point{4, 0}},
+		{"foo bar", Point{0, 0}, "vey$p", "foo barfoo", Point{9, 0}},
+		{"abcd", Point{1, 0}, "vlohd", "d", Point{0, 0}},
+		{"abc", Point{0, 0}, "vl\x1bdl", "ac", Point{1, 0}},
+		{"abc", Point{0, 0}, "vvdl", "bc", Point{0, 0}},
+		{"a\nb\nc", Point{0, 0}, "Vjd", "c", Point{0, 0}},
+		{"a\nb", Point{0, 0}, "vVd", "b", Point{0, 0}},
+		{"a\nb\nc", Point{0, 1}, "VyP", "a\nb\nb\nc", Point{0, 1}},
+		{"a\n\tb\nc", Point{0, 0}, "Vj>", "\ta\n\t\tb\nc", Point{1, 0}},
+		{"a", Point{0, 0}, "V2>", "\t\ta", Point{2, 0}},
+		{"    a\nb", Point{0, 0}, "V<", "a\nb", Point{0, 0}},
+		{"a\nb", Point{0, 0}, "2>>", "\ta\n\tb", Point{1, 0}},
+		{"Hello World", Point{0, 0}, "~~", "hEllo World", Point{2, 0}},
+		{"ab", Point{0, 0}, "3~", "AB", Point{1, 0}},
+		{"aé", Point{0, 0}, "$~", "aÉ", Point{1, 0}},
+		{"Hello", Point{0, 0}, "v$~", "hELLO", Point{0, 0}},
+		{"hello world", Point{0, 0}, "veU", "HELLO world", Point{0, 0}},
+		{"ABC", Point{0, 0}, "vlu", "abC", Point{0, 0}},
+		{"a\nb\nc", Point{0, 0}, "VjJ", "a b\nc", Point{1, 0}},
+		{"a\nb", Point{0, 0}, "vJ", "a b", Point{1, 0}},
+		{"foo bar", Point{4, 0}, "vecbaz\x1b", "foo baz", Point{6, 0}},
+		{"a\nb\nc", Point{0, 1}, "Vcx\x1b", "a\nx\nc", Point{0, 1}},
+		{"abcd\nefgh\nijkl", Point{1, 0}, "\x16jld", "ad\neh\nijkl", Point{1, 0}},
+		{"abc\ndef", Point{0, 0}, "\x16jy$p", "abca\ndefd", Point{3, 0}},
+		{"ab\ncd", Point{0, 0}, "\x16jyjp", "ab\ncad\n c", Point{1, 1}},
+		{"Abc\nDef", Point{1, 0}, "\x16j~", "ABc\nDEf", Point{1, 0}},
+		{"abc\ng\ndef", Point{1, 0}, "\x16jjlI-\x1b", "a-bc\ng\nd-ef", Point{1, 0}},
+		{"ab\nc\ndef", Point{0, 0}, "\x16jjlA!\x1b", "ab!\nc !\nde!f", Point{2, 0}},
+		{"abcd\nefgh", Point{1, 0}, "\x16jlcX\x1b", "aXd\neXh", Point{1, 0}},
+		{"ab\ncd\nef", Point{1, 0}, "\x16jjcZ\x1b", "aZ\ncZ\neZ", Point{1, 0}},
+		{"ab\ncd\nef", Point{0, 0}, "\x16jj$cZ\x1b", "Z\nZ\nZ", Point{0, 0}},
+		{"äbc\nabc", Point{0, 0}, "\x16jld", "c\nc", Point{0, 0}},
+		{"äb\nxy", Point{0, 0}, "\x16jy$p", "äbä\nxyx", Point{3, 0}},
+		{"äbc\nabc", Point{2, 0}, "\x16jI-\x1b", "ä-bc\na-bc", Point{2, 0}},
+		{"äb\nabc", Point{0, 0}, "\x16jlA!\x1b", "äb!\nab!c", Point{3, 0}},
+	}
+	runKeysTests(t, tests, handleKeys, func(vim *Vim, test keysTest) {
+		if vim.mode != MODE_NORMAL {
+			t.Errorf("mode %v after %q", vim.mode, test.keys)
+		}
+	})
+}
+
+func TestSelection(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("abcd\nefgh\nijkl")
+	buffer.SetCursor(Point{2, 0})
+
+	handleKeys(t, &vim, buffer, "vj")
+	selection := vim.Selection(buffer, buffer.Cursor())
+	for _, test := range []struct {
+		p        Point
+		selected bool
+	}{{Point{1, 0}, false}, {Point{3, 0}, true}, {Point{0, 1}, true}, {Point{3, 1}, false}} {
+		if selection.Contains(test.p, test.p.x) != test.selected {
+			t.Errorf("%v selected %v by v", test.p, !test.selected)
+		}
+	}
+
+	handleKeys(t, &vim, buffer, "\x16h")
+	selection = vim.Selection(buffer, buffer.Cursor())
+	for _, test := range []struct {
+		p        Point
+		selected bool
+	}{{Point{0, 0}, false}, {Point{1, 0}, true}, {Point{2, 1}, true}, {Point{3, 1}, false}, {Point{1, 2}, false}} {
+		if selection.Contains(test.p, test.p.x) != test.selected {
+			t.Errorf("%v selected %v by ctrl-v", test.p, !test.selected)
+		}
+	}
+
+	handleKeys(t, &vim, buffer, "\x1b")
+	if selection = vim.Selection(buffer, buffer.Cursor()); selection.Contains(Point{1, 0}, 1) {
+		t.Errorf("still selected after escape")
+	}
+	// a block selects by columns of characters rather than bytes
+	buffer = newTestBuffer("äbc\nabc")
+	handleKeys(t, &vim, buffer, "\x16jl")
+	selection = vim.Selection(buffer, buffer.Cursor())
+	if !selection.Contains(Point{2, 0}, 1) || selection.Contains(Point{1, 1}, 1) != true || selection.Contains(Point{2, 1}, 2) {
+		t.Errorf("unexpected block selection %+v", selection)
+	}
+}
+
+func TestBlockInsertUndo(t *testing.T) {
+	var vim Vim
+	vim.init()
+	buffer := newTestBuffer("a\nb\nc")
+
+	handleKeys(t, &vim, buffer, "\x16jjI# \x1b")
+	if expected := "# a\n# b\n# c\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after block insert, expected %q", StringifyBuffer(buffer), expected)
+	}
+
+	// the insert on every line is undone at once
+	handleKeys(t, &vim, buffer, "u")
+	if expected := "a\nb\nc\n"; StringifyBuffer(buffer) != expected {
+		t.Fatalf("buffer %q after undo, expected %q", StringifyBuffer(buffer), expected)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// helpers for moving over words the way vim does. a word is a run of letters,
+// digits and underscores or a run of other non-blank characters, a WORD (bigword)
+// is any run of non-blank characters. the position just after the end of each
+// line is the line break, which counts as blank
+
+type CharClass int
+
+const (
+	CHAR_CLASS_BLANK CharClass = iota
+	// an empty line is a word of its own
+	CHAR_CLASS_EMPTY_LINE
+	CHAR_CLASS_PUNCTUATION
+	CHAR_CLASS_WORD
+)
+
+// the class of the character at p
+func charClass(buffer Buffer, p Point, bigword bool) CharClass {
+	line := buffer.Lines()[p.y]
+	if len(line) == 0 {
+		return CHAR_CLASS_EMPTY_LINE
+	}
+	if p.x >= len(line) {
+		return CHAR_CLASS_BLANK
+	}
+
+	ch, _ := utf8.DecodeRuneInString(line[p.x:])
+	switch {
+	case unicode.IsSpace(ch):
+		return CHAR_CLASS_BLANK
+	case bigword:
+		return CHAR_CLASS_WORD
+	case ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch):
+		return CHAR_CLASS_WORD
+	}
+	return CHAR_CLASS_PUNCTUATION
+}
+
+// the character after p, including line breaks. returns false at the end of the buffer
+func nextPoint(buffer Buffer, p Point) (Point, bool) {
+	lines := buffer.Lines()
+	if line := lines[p.y]; p.x < len(line) {
+		_, size := utf8.DecodeRuneInString(line[p.x:])
+		return Point{p.x + size, p.y}, true
+	}
+	if p.y+1 < len(lines) {
+		return Point{0, p.y + 1}, true
+	}
+	return p, false
+}
+
+// the character before p, including line breaks. returns false at the start of the buffer
+func prevPoint(buffer Buffer, p Point) (Point, bool) {
+	lines := buffer.Lines()
+	if p.x > 0 {
+		_, size := utf8.DecodeLastRuneInString(lines[p.y][:p.x])
+		return Point{p.x - size, p.y}, true
+	}
+	if p.y > 0 {
+		return Point{len(lines[p.y-1]), p.y - 1}, true
+	}
+	return p, false
+}
+
+// the start of the word after p (w)
+func nextWordStart(buffer Buffer, p Point, bigword bool) Point {
+	start := charClass(buffer, p, bigword)
+	ok := true
+	if start == CHAR_CLASS_EMPTY_LINE {
+		p, ok = nextPoint(buffer, p)
+	}
+	for ok && start != CHAR_CLASS_BLANK && charClass(buffer, p, bigword) == start {
+		p, ok = nextPoint(buffer, p)
+	}
+	for ok && charClass(buffer, p, bigword) == CHAR_CLASS_BLANK {
+		p, ok = nextPoint(buffer, p)
+	}
+	return p
+}
+
+// the start of the word before p, or of the word p is in if it isn't at its start (b)
+func prevWordStart(buffer Buffer, p Point, bigword bool) Point {
+	p, ok := prevPoint(buffer, p)
+	for ok && charClass(buffer, p, bigword) == CHAR_CLASS_BLANK {
+		p, ok = prevPoint(buffer, p)
+	}
+
+	class := charClass(buffer, p, bigword)
+	if class == CHAR_CLASS_EMPTY_LINE {
+		return p
+	}
+	for {
+		before, ok := prevPoint(buffer, p)
+		if !ok || charClass(buffer, before, bigword) != class {
+			return p
+		}
+		p = before
+	}
+}
+
+// the end of the word after p, or of the word p is in if it isn't at its end (e)
+func nextWordEnd(buffer Buffer, p Point, bigword bool) Point {
+	p, ok := nextPoint(buffer, p)
+	for ok {
+		if class := charClass(buffer, p, bigword); class != CHAR_CLASS_BLANK && class != CHAR_CLASS_EMPTY_LINE {
+			break
+		}
+		p, ok = nextPoint(buffer, p)
+	}
+
+	class := charClass(buffer, p, bigword)
+	for {
+		after, ok := nextPoint(buffer, p)
+		if !ok || charClass(buffer, after, bigword) != class {
+			return p
+		}
+		p = after
+	}
+}
+
+// the end of the word before p (ge)
+func prevWordEnd(buffer Buffer, p Point, bigword bool) Point {
+	start := charClass(buffer, p, bigword)
+	p, ok := prevPoint(buffer, p)
+	for ok && start != CHAR_CLASS_BLANK && start != CHAR_CLASS_EMPTY_LINE && charClass(buffer, p, bigword) == start {
+		p, ok = prevPoint(buffer, p)
+	}
+	for ok && charClass(buffer, p, bigword) == CHAR_CLASS_BLANK {
+		p, ok = prevPoint(buffer, p)
+	}
+	return p
+}